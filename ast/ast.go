@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"strings"
 
 	"github.com/sscaling/monkey/token"
 )
@@ -10,6 +11,11 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+
+	// Pos and End give the span of source the node was parsed from, End
+	// being the position just after it. A statement doesn't include its ;
+	Pos() token.Pos
+	End() token.Pos
 }
 
 type Statement interface {
@@ -26,6 +32,10 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+
+	// every comment in the source, in order, when the lexer returns them
+	// (see lexer.WithComments)
+	Comments []*Comment
 }
 
 func (p *Program) TokenLiteral() string {
@@ -35,6 +45,18 @@ func (p *Program) TokenLiteral() string {
 		return ""
 	}
 }
+func (p *Program) Pos() token.Pos {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.NoPos
+}
+func (p *Program) End() token.Pos {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.NoPos
+}
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -45,6 +67,27 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// -------- COMMENT -------
+
+// Comment is a // or /* */ comment, the literal being all of it including the
+// markers
+type Comment struct {
+	Token token.Token
+}
+
+func (c *Comment) TokenLiteral() string {
+	return c.Token.Literal
+}
+func (c *Comment) Pos() token.Pos {
+	return token.Pos(c.Token.Position)
+}
+func (c *Comment) End() token.Pos {
+	return token.Pos(c.Token.End)
+}
+func (c *Comment) String() string {
+	return c.Token.Literal
+}
+
 // -------- IDENTIFIER -------
 
 type Identifier struct {
@@ -56,6 +99,12 @@ func (i *Identifier) expressionNode() {}
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (i *Identifier) Pos() token.Pos {
+	return token.Pos(i.Token.Position)
+}
+func (i *Identifier) End() token.Pos {
+	return token.Pos(i.Token.End)
+}
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -72,6 +121,15 @@ func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
+func (ls *LetStatement) Pos() token.Pos {
+	return token.Pos(ls.Token.Position)
+}
+func (ls *LetStatement) End() token.Pos {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+	return ls.Name.End()
+}
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -100,6 +158,15 @@ func (rs *ReturnStatement) statementNode() {}
 func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
+func (rs *ReturnStatement) Pos() token.Pos {
+	return token.Pos(rs.Token.Position)
+}
+func (rs *ReturnStatement) End() token.Pos {
+	if rs.Value != nil {
+		return rs.Value.End()
+	}
+	return token.Pos(rs.Token.End)
+}
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -125,6 +192,12 @@ func (es *ExpressionStatement) statementNode() {}
 func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
+func (es *ExpressionStatement) Pos() token.Pos {
+	return es.Expression.Pos()
+}
+func (es *ExpressionStatement) End() token.Pos {
+	return es.Expression.End()
+}
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -144,10 +217,58 @@ func (il *IntegerLiteral) expressionNode() {}
 func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
+func (il *IntegerLiteral) Pos() token.Pos {
+	return token.Pos(il.Token.Position)
+}
+func (il *IntegerLiteral) End() token.Pos {
+	return token.Pos(il.Token.End)
+}
 func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
 
+// -------- FLOAT LITERAL ------
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+func (fl *FloatLiteral) Pos() token.Pos {
+	return token.Pos(fl.Token.Position)
+}
+func (fl *FloatLiteral) End() token.Pos {
+	return token.Pos(fl.Token.End)
+}
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Literal
+}
+
+// -------- STRING LITERAL ------
+
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode() {}
+func (sl *StringLiteral) TokenLiteral() string {
+	return sl.Token.Literal
+}
+func (sl *StringLiteral) Pos() token.Pos {
+	return token.Pos(sl.Token.Position)
+}
+func (sl *StringLiteral) End() token.Pos {
+	return token.Pos(sl.Token.End)
+}
+func (sl *StringLiteral) String() string {
+	return sl.Token.Literal
+}
+
 // --------- PREFIX EXPRESSION ----
 
 type PrefixExpression struct {
@@ -160,10 +281,43 @@ func (pe *PrefixExpression) expressionNode() {}
 func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
+func (pe *PrefixExpression) Pos() token.Pos {
+	return token.Pos(pe.Token.Position)
+}
+func (pe *PrefixExpression) End() token.Pos {
+	return pe.Right.End()
+}
 func (pe *PrefixExpression) String() string {
 	return fmt.Sprintf("(%s%s)", pe.Operator, pe.Right)
 }
 
+// -------- GROUPED EXPRESSION --------
+
+// GroupedExpression is an expression in parentheses, kept so that spans of
+// source include them
+type GroupedExpression struct {
+	Token      token.Token // (
+	Expression Expression
+	Rparen     token.Pos // of the closing )
+}
+
+func (ge *GroupedExpression) expressionNode() {}
+func (ge *GroupedExpression) TokenLiteral() string {
+	return ge.Token.Literal
+}
+func (ge *GroupedExpression) Pos() token.Pos {
+	return token.Pos(ge.Token.Position)
+}
+func (ge *GroupedExpression) End() token.Pos {
+	return ge.Rparen + 1
+}
+
+// String is that of the expression alone, since the other expressions
+// already show their grouping
+func (ge *GroupedExpression) String() string {
+	return ge.Expression.String()
+}
+
 // -------- INFIX EXPRESSION --------
 
 type InfixExpression struct {
@@ -177,6 +331,253 @@ func (ie *InfixExpression) expressionNode() {}
 func (ie *InfixExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *InfixExpression) Pos() token.Pos {
+	return ie.Left.Pos()
+}
+func (ie *InfixExpression) End() token.Pos {
+	return ie.Right.End()
+}
 func (ie *InfixExpression) String() string {
 	return fmt.Sprintf("(%s %s %s)", ie.Left, ie.Operator, ie.Right)
 }
+
+// -------- BOOLEAN --------
+
+type Boolean struct {
+	Token token.Token
+	Value bool
+}
+
+func (b *Boolean) expressionNode() {}
+func (b *Boolean) TokenLiteral() string {
+	return b.Token.Literal
+}
+func (b *Boolean) Pos() token.Pos {
+	return token.Pos(b.Token.Position)
+}
+func (b *Boolean) End() token.Pos {
+	return token.Pos(b.Token.End)
+}
+func (b *Boolean) String() string {
+	return b.Token.Literal
+}
+
+// -------- BLOCK STATEMENT --------
+
+type BlockStatement struct {
+	Token      token.Token // {
+	Statements []Statement
+	Rbrace     token.Pos // of the closing }
+}
+
+func (bs *BlockStatement) statementNode() {}
+func (bs *BlockStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+func (bs *BlockStatement) Pos() token.Pos {
+	return token.Pos(bs.Token.Position)
+}
+func (bs *BlockStatement) End() token.Pos {
+	return bs.Rbrace + 1
+}
+func (bs *BlockStatement) String() string {
+	var out bytes.Buffer
+
+	for _, s := range bs.Statements {
+		out.WriteString(s.String())
+	}
+
+	return out.String()
+}
+
+// -------- IF EXPRESSION --------
+
+type IfExpression struct {
+	Token       token.Token // if
+	Condition   Expression
+	Consequence *BlockStatement
+	Alternative *BlockStatement
+}
+
+func (ie *IfExpression) expressionNode() {}
+func (ie *IfExpression) TokenLiteral() string {
+	return ie.Token.Literal
+}
+func (ie *IfExpression) Pos() token.Pos {
+	return token.Pos(ie.Token.Position)
+}
+func (ie *IfExpression) End() token.Pos {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	return ie.Consequence.End()
+}
+func (ie *IfExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("if")
+	out.WriteString(ie.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ie.Consequence.String())
+
+	if ie.Alternative != nil {
+		out.WriteString("else ")
+		out.WriteString(ie.Alternative.String())
+	}
+
+	return out.String()
+}
+
+// -------- FUNCTION LITERAL --------
+
+type FunctionLiteral struct {
+	Token      token.Token // fn
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (fl *FunctionLiteral) expressionNode() {}
+func (fl *FunctionLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+func (fl *FunctionLiteral) Pos() token.Pos {
+	return token.Pos(fl.Token.Position)
+}
+func (fl *FunctionLiteral) End() token.Pos {
+	return fl.Body.End()
+}
+func (fl *FunctionLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range fl.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(fl.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fl.Body.String())
+
+	return out.String()
+}
+
+// -------- CALL EXPRESSION --------
+
+type CallExpression struct {
+	Token     token.Token // (
+	Function  Expression  // Identifier or FunctionLiteral
+	Arguments []Expression
+	Rparen    token.Pos // of the closing )
+}
+
+func (ce *CallExpression) expressionNode() {}
+func (ce *CallExpression) TokenLiteral() string {
+	return ce.Token.Literal
+}
+func (ce *CallExpression) Pos() token.Pos {
+	return ce.Function.Pos()
+}
+func (ce *CallExpression) End() token.Pos {
+	return ce.Rparen + 1
+}
+func (ce *CallExpression) String() string {
+	var out bytes.Buffer
+
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+
+	out.WriteString(ce.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// -------- ARRAY LITERAL --------
+
+type ArrayLiteral struct {
+	Token    token.Token // [
+	Elements []Expression
+	Rbracket token.Pos // of the closing ]
+}
+
+func (al *ArrayLiteral) expressionNode() {}
+func (al *ArrayLiteral) TokenLiteral() string {
+	return al.Token.Literal
+}
+func (al *ArrayLiteral) Pos() token.Pos {
+	return token.Pos(al.Token.Position)
+}
+func (al *ArrayLiteral) End() token.Pos {
+	return al.Rbracket + 1
+}
+func (al *ArrayLiteral) String() string {
+	elements := []string{}
+	for _, e := range al.Elements {
+		elements = append(elements, e.String())
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// -------- INDEX EXPRESSION --------
+
+type IndexExpression struct {
+	Token    token.Token // [
+	Left     Expression
+	Index    Expression
+	Rbracket token.Pos // of the closing ]
+}
+
+func (ie *IndexExpression) expressionNode() {}
+func (ie *IndexExpression) TokenLiteral() string {
+	return ie.Token.Literal
+}
+func (ie *IndexExpression) Pos() token.Pos {
+	return ie.Left.Pos()
+}
+func (ie *IndexExpression) End() token.Pos {
+	return ie.Rbracket + 1
+}
+func (ie *IndexExpression) String() string {
+	return fmt.Sprintf("(%s[%s])", ie.Left, ie.Index)
+}
+
+// -------- HASH LITERAL --------
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+// HashLiteral keeps its pairs in source order, so that evaluating them (and
+// any errors) happens in a predictable order
+type HashLiteral struct {
+	Token  token.Token // {
+	Pairs  []HashPair
+	Rbrace token.Pos // of the closing }
+}
+
+func (hl *HashLiteral) expressionNode() {}
+func (hl *HashLiteral) TokenLiteral() string {
+	return hl.Token.Literal
+}
+func (hl *HashLiteral) Pos() token.Pos {
+	return token.Pos(hl.Token.Position)
+}
+func (hl *HashLiteral) End() token.Pos {
+	return hl.Rbrace + 1
+}
+func (hl *HashLiteral) String() string {
+	pairs := []string{}
+	for _, p := range hl.Pairs {
+		pairs = append(pairs, p.Key.String()+": "+p.Value.String())
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
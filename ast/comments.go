@@ -0,0 +1,85 @@
+package ast
+
+import "github.com/sscaling/monkey/token"
+
+// A CommentMap associates each comment with the node it's nearest to, so tools
+// which rewrite the tree can keep them
+type CommentMap map[Node][]*Comment
+
+// NewCommentMap associates the comments of program with its statements. f is
+// the file it was parsed from, giving line numbers. A comment goes to
+//   - the statement ending on the same line, before the comment
+//   - the statement it's within, unless it's within one of its blocks
+//   - otherwise, the statement after it
+//   - or if there isn't one, the block or program it ends
+func NewCommentMap(f *token.File, program *Program) CommentMap {
+	cmap := CommentMap{}
+	cmap.add(f, program, program.Statements, program.Comments)
+	return cmap
+}
+
+// add associates comments, which are all within owner, with the statements of
+// list
+func (cmap CommentMap) add(f *token.File, owner Node, list []Statement, comments []*Comment) {
+	i := 0 // the first statement not ending before the comment
+	for len(comments) > 0 {
+		c := comments[0]
+		for i < len(list) && list[i].End() <= c.Pos() {
+			i++
+		}
+
+		switch {
+		case i < len(list) && list[i].Pos() <= c.Pos():
+			n := 1
+			for n < len(comments) && comments[n].Pos() < list[i].End() {
+				n++
+			}
+			cmap.addWithin(f, list[i], comments[:n])
+			comments = comments[n:]
+			continue
+		case i > 0 && f.Position(c.Pos()).Line == f.Position(list[i-1].End()).Line:
+			cmap[list[i-1]] = append(cmap[list[i-1]], c)
+		case i < len(list):
+			cmap[list[i]] = append(cmap[list[i]], c)
+		default:
+			cmap[owner] = append(cmap[owner], c)
+		}
+
+		comments = comments[1:]
+	}
+}
+
+// addWithin associates comments within s with it, or with the statements of
+// the block they're within
+func (cmap CommentMap) addWithin(f *token.File, s Statement, comments []*Comment) {
+	blocks := []*BlockStatement{}
+	Inspect(s, func(n Node) bool {
+		if b, ok := n.(*BlockStatement); ok && Node(b) != s {
+			blocks = append(blocks, b)
+			return false
+		}
+		return true
+	})
+
+	within := map[*BlockStatement][]*Comment{}
+	for _, c := range comments {
+		inBlock := false
+		for _, b := range blocks {
+			if b.Pos() < c.Pos() && c.End() < b.End() {
+				within[b] = append(within[b], c)
+				inBlock = true
+				break
+			}
+		}
+
+		if !inBlock {
+			cmap[s] = append(cmap[s], c)
+		}
+	}
+
+	for _, b := range blocks {
+		if len(within[b]) > 0 {
+			cmap.add(f, b, b.Statements, within[b])
+		}
+	}
+}
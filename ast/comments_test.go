@@ -0,0 +1,64 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/sscaling/monkey/ast"
+	"github.com/sscaling/monkey/lexer"
+	"github.com/sscaling/monkey/parser"
+	"github.com/sscaling/monkey/token"
+)
+
+func TestCommentMap(t *testing.T) {
+	input := `// leading a
+let a = 1; // trailing a
+let f = fn(x) { // leading x
+	x + /* inner */ 1
+	// end of body
+};
+f(a)
+// end of program`
+
+	fset := token.NewFileSet()
+	file := fset.AddFile("", input)
+
+	program := parser.New(lexer.NewFile(file, lexer.WithComments())).ParseProgram()
+	if len(program.Comments) != 6 {
+		t.Fatalf("expected 6 comments, got %d", len(program.Comments))
+	}
+
+	fn := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	body := fn.Body.Statements[0]
+
+	expected := []struct {
+		node     ast.Node
+		comments []string
+	}{
+		{program.Statements[0], []string{"// leading a", "// trailing a"}},
+		{program.Statements[1], nil},
+		{body, []string{"// leading x", "/* inner */"}},
+		{fn.Body, []string{"// end of body"}},
+		{program.Statements[2], nil},
+		{program, []string{"// end of program"}},
+	}
+
+	cmap := ast.NewCommentMap(file, program)
+	for _, e := range expected {
+		comments := []string{}
+		for _, c := range cmap[e.node] {
+			comments = append(comments, c.String())
+		}
+
+		if len(comments) != len(e.comments) {
+			t.Errorf("%s: expected comments %q, got %q", e.node, e.comments, comments)
+			continue
+		}
+
+		for i := range comments {
+			if comments[i] != e.comments[i] {
+				t.Errorf("%s: expected comments %q, got %q", e.node, e.comments, comments)
+				break
+			}
+		}
+	}
+}
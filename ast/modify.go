@@ -0,0 +1,100 @@
+package ast
+
+// ModifierFunc returns the node to use in place of the one given, which may
+// be the same node
+type ModifierFunc func(Node) Node
+
+// Modify rewrites the tree rooted at node depth-first, children before their
+// parent. The fields of each node are updated in place with what modifier
+// returns for them, and the result for node itself is returned. A child which
+// is replaced with a node of the wrong kind (i.e. a statement in place of an
+// expression) is set to nil.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+
+	// statements
+	case *Program:
+		modifyStatements(n.Statements, modifier)
+	case *LetStatement:
+		n.Name = modifyIdentifier(n.Name, modifier)
+		n.Value = modifyExpression(n.Value, modifier)
+	case *ReturnStatement:
+		n.Value = modifyExpression(n.Value, modifier)
+	case *ExpressionStatement:
+		n.Expression = modifyExpression(n.Expression, modifier)
+	case *BlockStatement:
+		modifyStatements(n.Statements, modifier)
+
+	// expressions
+	case *PrefixExpression:
+		n.Right = modifyExpression(n.Right, modifier)
+	case *InfixExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Right = modifyExpression(n.Right, modifier)
+	case *GroupedExpression:
+		n.Expression = modifyExpression(n.Expression, modifier)
+	case *IfExpression:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Consequence = modifyBlock(n.Consequence, modifier)
+		n.Alternative = modifyBlock(n.Alternative, modifier)
+	case *FunctionLiteral:
+		for i, p := range n.Parameters {
+			n.Parameters[i] = modifyIdentifier(p, modifier)
+		}
+		n.Body = modifyBlock(n.Body, modifier)
+	case *CallExpression:
+		n.Function = modifyExpression(n.Function, modifier)
+		for i, a := range n.Arguments {
+			n.Arguments[i] = modifyExpression(a, modifier)
+		}
+	case *ArrayLiteral:
+		for i, e := range n.Elements {
+			n.Elements[i] = modifyExpression(e, modifier)
+		}
+	case *IndexExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Index = modifyExpression(n.Index, modifier)
+	case *HashLiteral:
+		for i, p := range n.Pairs {
+			n.Pairs[i].Key = modifyExpression(p.Key, modifier)
+			n.Pairs[i].Value = modifyExpression(p.Value, modifier)
+		}
+	}
+
+	return modifier(node)
+}
+
+func modifyStatements(list []Statement, modifier ModifierFunc) {
+	for i, s := range list {
+		if s != nil {
+			list[i], _ = Modify(s, modifier).(Statement)
+		}
+	}
+}
+
+func modifyExpression(e Expression, modifier ModifierFunc) Expression {
+	if e == nil {
+		return nil
+	}
+
+	modified, _ := Modify(e, modifier).(Expression)
+	return modified
+}
+
+func modifyIdentifier(i *Identifier, modifier ModifierFunc) *Identifier {
+	if i == nil {
+		return nil
+	}
+
+	modified, _ := Modify(i, modifier).(*Identifier)
+	return modified
+}
+
+func modifyBlock(b *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+
+	modified, _ := Modify(b, modifier).(*BlockStatement)
+	return modified
+}
@@ -0,0 +1,66 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/sscaling/monkey/ast"
+)
+
+func TestModify(t *testing.T) {
+	// replace every 1 with 2, and rename x to y
+	modifier := func(node ast.Node) ast.Node {
+		switch n := node.(type) {
+		case *ast.IntegerLiteral:
+			if n.Value == 1 {
+				n.Value = 2
+				n.Token.Literal = "2"
+			}
+		case *ast.Identifier:
+			if n.Value == "x" {
+				return &ast.Identifier{Token: n.Token, Value: "y"}
+			}
+		}
+		return node
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1", "2"},
+		{"1 + x", "(2 + y)"},
+		{"-(1)", "(-2)"},
+		{"let x = 1;", "let y = 2;"},
+		{"return x", "returny;"},
+		{"if (x) { 1 } else { x }", "ify 2else y"},
+		{"fn(x) { x + 1 }", "fn(y) (y + 2)"},
+		{"x(1, fn() { x })", "y(2, fn() y)"},
+		{"[1, x][x]", "([2, y][y])"},
+		{"{x: 1, 1: x}", "{y: 2, 2: y}"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+
+		modified := ast.Modify(program, modifier)
+		if modified.String() != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, modified.String())
+		}
+	}
+}
+
+func TestModifyReplacesRoot(t *testing.T) {
+	program := parse(t, "5")
+
+	replacement := &ast.Program{}
+	modified := ast.Modify(program, func(node ast.Node) ast.Node {
+		if _, ok := node.(*ast.Program); ok {
+			return replacement
+		}
+		return node
+	})
+
+	if modified != replacement {
+		t.Errorf("expected the program to be replaced, got %v", modified)
+	}
+}
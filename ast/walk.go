@@ -0,0 +1,120 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is called for each node found by Walk. If it
+// returns a visitor w, Walk visits each of the children of node with w,
+// followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node depth-first, in source order. It
+// starts by calling v.Visit(node). Missing (nil) children are skipped.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+
+	// statements
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *LetStatement:
+		walkIdentifier(v, n.Name)
+		walkExpression(v, n.Value)
+	case *ReturnStatement:
+		walkExpression(v, n.Value)
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	// expressions
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean, *Comment:
+		// no children
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+	case *GroupedExpression:
+		walkExpression(v, n.Expression)
+	case *IfExpression:
+		walkExpression(v, n.Condition)
+		walkBlock(v, n.Consequence)
+		walkBlock(v, n.Alternative)
+	case *FunctionLiteral:
+		for _, p := range n.Parameters {
+			walkIdentifier(v, p)
+		}
+		walkBlock(v, n.Body)
+	case *CallExpression:
+		walkExpression(v, n.Function)
+		for _, a := range n.Arguments {
+			walkExpression(v, a)
+		}
+	case *ArrayLiteral:
+		for _, e := range n.Elements {
+			walkExpression(v, e)
+		}
+	case *IndexExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Index)
+	case *HashLiteral:
+		for _, p := range n.Pairs {
+			walkExpression(v, p.Key)
+			walkExpression(v, p.Value)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+// the typed helpers avoid visiting nil pointers wrapped in a non-nil interface
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, s := range list {
+		if s != nil {
+			Walk(v, s)
+		}
+	}
+}
+
+func walkExpression(v Visitor, e Expression) {
+	if e != nil {
+		Walk(v, e)
+	}
+}
+
+func walkIdentifier(v Visitor, i *Identifier) {
+	if i != nil {
+		Walk(v, i)
+	}
+}
+
+func walkBlock(v Visitor, b *BlockStatement) {
+	if b != nil {
+		Walk(v, b)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node depth-first, in source order. It
+// calls f(node) and, if that returns true, inspects each of the children of
+// node followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
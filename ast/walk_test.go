@@ -0,0 +1,140 @@
+package ast_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sscaling/monkey/ast"
+	"github.com/sscaling/monkey/lexer"
+	"github.com/sscaling/monkey/parser"
+)
+
+const walkInput = `let add = fn(a, b) { return a + b; };
+if (!(add(1, 2) > 3)) { "big" } else { false }`
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+// nodeName gives the type of a node, without the package or pointer
+func nodeName(n ast.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast.")
+}
+
+type recorder struct {
+	events *[]string
+}
+
+func (r recorder) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		*r.events = append(*r.events, "end")
+		return nil
+	}
+
+	*r.events = append(*r.events, nodeName(node))
+	return r
+}
+
+func TestWalk(t *testing.T) {
+	var events []string
+	ast.Walk(recorder{&events}, parse(t, walkInput))
+
+	expected := []string{
+		"Program",
+		"LetStatement",
+		"Identifier", "end",
+		"FunctionLiteral",
+		"Identifier", "end",
+		"Identifier", "end",
+		"BlockStatement",
+		"ReturnStatement",
+		"InfixExpression",
+		"Identifier", "end",
+		"Identifier", "end",
+		"end", // InfixExpression
+		"end", // ReturnStatement
+		"end", // BlockStatement
+		"end", // FunctionLiteral
+		"end", // LetStatement
+		"ExpressionStatement",
+		"IfExpression",
+		"PrefixExpression",
+		"GroupedExpression",
+		"InfixExpression",
+		"CallExpression",
+		"Identifier", "end",
+		"IntegerLiteral", "end",
+		"IntegerLiteral", "end",
+		"end", // CallExpression
+		"IntegerLiteral", "end",
+		"end", // InfixExpression
+		"end", // GroupedExpression
+		"end", // PrefixExpression
+		"BlockStatement",
+		"ExpressionStatement",
+		"StringLiteral", "end",
+		"end", // ExpressionStatement
+		"end", // BlockStatement
+		"BlockStatement",
+		"ExpressionStatement",
+		"Boolean", "end",
+		"end", // ExpressionStatement
+		"end", // BlockStatement
+		"end", // IfExpression
+		"end", // ExpressionStatement
+		"end", // Program
+	}
+
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("unexpected walk.\nwant=%v\ngot =%v", expected, events)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	program := parse(t, walkInput)
+
+	// collect identifiers, but don't descend into function literals
+	var idents []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			idents = append(idents, n.Value)
+		case *ast.FunctionLiteral:
+			return false
+		}
+		return true
+	})
+
+	expected := []string{"add", "add"}
+	if !reflect.DeepEqual(idents, expected) {
+		t.Errorf("expected identifiers %v, got %v", expected, idents)
+	}
+}
+
+func TestWalkSkipsMissingNodes(t *testing.T) {
+	program := &ast.Program{
+		Statements: []ast.Statement{
+			&ast.LetStatement{Name: &ast.Identifier{Value: "x"}},
+			&ast.ExpressionStatement{Expression: &ast.IfExpression{Consequence: &ast.BlockStatement{}}},
+		},
+	}
+
+	count := 0
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n != nil {
+			count++
+		}
+		return true
+	})
+
+	if count != 6 {
+		t.Errorf("expected 6 nodes, got %d", count)
+	}
+}
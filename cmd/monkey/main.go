@@ -0,0 +1,316 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sscaling/monkey/ast"
+	"github.com/sscaling/monkey/compiler"
+	"github.com/sscaling/monkey/evaluator"
+	"github.com/sscaling/monkey/format"
+	"github.com/sscaling/monkey/lexer"
+	"github.com/sscaling/monkey/object"
+	"github.com/sscaling/monkey/parser"
+	"github.com/sscaling/monkey/repl"
+	"github.com/sscaling/monkey/token"
+	"github.com/sscaling/monkey/vm"
+)
+
+// exit codes
+const (
+	exitOK           = 0
+	exitRuntimeError = 1
+	exitUsage        = 2
+	exitParseError   = 3
+)
+
+const usage = `Usage: monkey <command> [arguments]
+
+Commands:
+  run [-engine eval|vm] <file>   run a program
+  lex [-comments] <file>         print the tokens of a program
+  parse <file>                   print the parsed statements of a program
+  fmt [-w] [-l] <file>...        print programs in the canonical format
+  repl [-engine eval|vm]         start an interactive session (the default)
+
+'monkey <file>' is the same as 'monkey run <file>', so a program can start
+with a '#!/usr/bin/env monkey' line.
+`
+
+func main() {
+	os.Exit(dispatch(os.Args[1:]))
+}
+
+func dispatch(args []string) int {
+	if len(args) == 0 {
+		return replCommand(args)
+	}
+
+	switch args[0] {
+	case "run":
+		return runCommand(args[1:])
+	case "lex":
+		return lexCommand(args[1:])
+	case "parse":
+		return parseCommand(args[1:])
+	case "fmt":
+		return fmtCommand(args[1:])
+	case "repl":
+		return replCommand(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return exitOK
+	default:
+		if strings.HasPrefix(args[0], "-") {
+			// flags without a command, i.e. 'monkey -engine vm'
+			return replCommand(args)
+		}
+		return runCommand(args)
+	}
+}
+
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	engine := engineFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if !validEngine(*engine) {
+		return exitUsage
+	}
+
+	program, code := parseFile(flags)
+	if program == nil {
+		return code
+	}
+
+	var result object.Object
+	if *engine == repl.EngineVM {
+		result = runVM(program)
+	} else {
+		result = evaluator.Eval(program, object.NewEnvironment())
+	}
+
+	if result == nil {
+		return exitOK
+	}
+
+	if result.Type() == object.ERROR_OBJ {
+		fmt.Fprintln(os.Stderr, result.Inspect())
+		return exitRuntimeError
+	}
+
+	if result.Type() != object.NULL_OBJ {
+		fmt.Println(result.Inspect())
+	}
+
+	return exitOK
+}
+
+func runVM(program *ast.Program) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	machine := vm.New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	if !repl.HasValue(program) {
+		return nil
+	}
+
+	return machine.LastPoppedStackElem()
+}
+
+func lexCommand(args []string) int {
+	flags := flag.NewFlagSet("lex", flag.ContinueOnError)
+	comments := flags.Bool("comments", false, "include comments in the tokens")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	src, code := readFile(flags)
+	if code != exitOK {
+		return code
+	}
+
+	opts := []lexer.Option{}
+	if *comments {
+		opts = append(opts, lexer.WithComments())
+	}
+
+	l := lexer.New(src, opts...)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Println(tok.Pretty())
+	}
+
+	if errors := l.Errors(); len(errors) != 0 {
+		for _, e := range errors {
+			err := &parser.ParseError{Code: e.Code, Message: e.Message, Line: e.Line, Column: e.Column, Offset: e.Offset}
+			fmt.Fprint(os.Stderr, parser.RenderError(src, err))
+		}
+		return exitParseError
+	}
+
+	return exitOK
+}
+
+func parseCommand(args []string) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	program, code := parseFile(flags)
+	if program == nil {
+		return code
+	}
+
+	for _, s := range program.Statements {
+		fmt.Println(s.String())
+	}
+
+	return exitOK
+}
+
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the result back to the file instead of printing it")
+	list := flags.Bool("l", false, "list the files whose formatting differs")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "fmt expects at least one file\n\n%s", usage)
+		return exitUsage
+	}
+
+	code := exitOK
+	for _, filename := range flags.Args() {
+		if c := formatFile(filename, *write, *list); c > code {
+			code = c
+		}
+	}
+
+	return code
+}
+
+// formatFile formats a single file for fmtCommand. A leading #! line is
+// split off before formatting and put back unchanged in front of the result.
+func formatFile(filename string, write, list bool) int {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	// the newline after the #! stays with src, so error lines match the file
+	shebang, src := repl.SplitShebang(string(b))
+	if shebang != "" {
+		shebang += "\n"
+	}
+
+	out, err := format.Source(src)
+	if err != nil {
+		if e, ok := err.(*format.Error); ok {
+			fmt.Fprintf(os.Stderr, "%s:\n%s", filename, parser.RenderErrors(src, e.Errors))
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return exitParseError
+	}
+	out = shebang + out
+
+	if list && out != string(b) {
+		fmt.Println(filename)
+	}
+
+	if write {
+		if out != string(b) {
+			if err := ioutil.WriteFile(filename, []byte(out), 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitRuntimeError
+			}
+		}
+	} else if !list {
+		fmt.Print(out)
+	}
+
+	return exitOK
+}
+
+func replCommand(args []string) int {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	engine := engineFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if !validEngine(*engine) {
+		return exitUsage
+	}
+
+	fmt.Println("Monkey")
+
+	repl.Start(os.Stdin, os.Stdout, *engine)
+
+	return exitOK
+}
+
+func engineFlag(flags *flag.FlagSet) *string {
+	return flags.String("engine", repl.EngineEval, "engine to run programs with: 'eval' or 'vm'")
+}
+
+func validEngine(engine string) bool {
+	if engine != repl.EngineEval && engine != repl.EngineVM {
+		fmt.Fprintf(os.Stderr, "unknown engine %q\n", engine)
+		return false
+	}
+
+	return true
+}
+
+// parseFile parses the file named by the only argument, reporting any errors.
+// The returned program is nil if it couldn't be parsed.
+func parseFile(flags *flag.FlagSet) (*ast.Program, int) {
+	src, code := readFile(flags)
+	if code != exitOK {
+		return nil, code
+	}
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+
+	if errors := p.Errors(); len(errors) != 0 {
+		fmt.Fprint(os.Stderr, parser.RenderErrors(src, errors))
+		return nil, exitParseError
+	}
+
+	return program, exitOK
+}
+
+// readFile reads the file named by the only argument, dropping a leading #!
+// line but not its newline, so that line numbers still match the file
+func readFile(flags *flag.FlagSet) (string, int) {
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "%s expects a single file, got %d arguments\n\n%s", flags.Name(), flags.NArg(), usage)
+		return "", exitUsage
+	}
+
+	b, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return "", exitUsage
+	}
+
+	_, src := repl.SplitShebang(string(b))
+	return src, exitOK
+}
@@ -0,0 +1,220 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+// String disassembles the instructions, one per line prefixed with its offset
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpGreaterThanOrEqual
+	OpLessThanOrEqual
+
+	OpMinus
+	OpBang
+
+	OpJumpNotTruthy
+	OpJump
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+
+	OpCall
+	OpReturnValue
+	OpReturn
+
+	OpArray
+	OpHash
+	OpIndex
+	OpGetBuiltin
+
+	OpClosure
+	OpGetFree
+	OpCurrentClosure
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int // number of bytes used by each operand
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}}, // index into the constant pool
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:              {"OpEqual", []int{}},
+	OpNotEqual:           {"OpNotEqual", []int{}},
+	OpGreaterThan:        {"OpGreaterThan", []int{}},
+	OpLessThan:           {"OpLessThan", []int{}},
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+	OpLessThanOrEqual:    {"OpLessThanOrEqual", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}}, // absolute offset to jump to
+	OpJump:          {"OpJump", []int{2}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}}, // index of the global binding
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+	OpGetLocal:  {"OpGetLocal", []int{1}}, // index of the local binding in the frame
+	OpSetLocal:  {"OpSetLocal", []int{1}},
+
+	OpCall:        {"OpCall", []int{1}}, // number of arguments
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpArray:      {"OpArray", []int{2}}, // number of elements
+	OpHash:       {"OpHash", []int{2}},  // number of keys and values
+	OpIndex:      {"OpIndex", []int{}},
+	OpGetBuiltin: {"OpGetBuiltin", []int{2}}, // number of the builtin in object.Builtins
+
+	OpClosure:        {"OpClosure", []int{2, 1}}, // constant index of the function, number of free variables
+	OpGetFree:        {"OpGetFree", []int{1}},    // index of the free variable in the closure
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// MaxOperand is the largest value an operand width bytes wide can hold
+func MaxOperand(width int) int {
+	return 1<<(8*uint(width)) - 1
+}
+
+// Make encodes an instruction, operands are written big endian. An operand
+// too large for its width is truncated, see MaxOperand.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of def, returning them with the number of bytes read
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
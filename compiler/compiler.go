@@ -0,0 +1,552 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/sscaling/monkey/ast"
+	"github.com/sscaling/monkey/code"
+	"github.com/sscaling/monkey/object"
+)
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions being emitted for a function body
+// (or the main program)
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// the first operand which was too large for its instruction
+	err error
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions: code.Instructions{},
+	}
+
+	symbolTable := NewSymbolTable()
+	for i, b := range object.Builtins.All() {
+		symbolTable.DefineBuiltin(i, b.Name)
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+	}
+}
+
+// NewWithState creates a compiler which carries on from the globals and
+// constants of a previous compilation, i.e. for the repl. The builtins need
+// to have been defined in s.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	c := New()
+	c.symbolTable = s
+	c.constants = constants
+	return c
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+	}
+}
+
+// Compile compiles node, which fails if the program is too large for the
+// operands of the instructions, as well as for the errors in it
+func (c *Compiler) Compile(node ast.Node) error {
+	if err := c.compile(node); err != nil {
+		return err
+	}
+
+	return c.err
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	switch node := node.(type) {
+
+	// statements
+	case *ast.Program:
+		for _, s := range node.Statements {
+			if err := c.compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.ExpressionStatement:
+		if err := c.compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.LetStatement:
+		// a function can refer to itself, any other value only sees a previous binding
+		var err error
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			err = c.compileFunctionLiteral(fn, node.Name.Value)
+		} else {
+			err = c.compile(node.Value)
+		}
+		if err != nil {
+			return err
+		}
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+	case *ast.ReturnStatement:
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	// expressions
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.Identifier:
+		symbol, err := c.symbolTable.Resolve(node.Value)
+		if err != nil {
+			return err
+		}
+		c.loadSymbol(symbol)
+	case *ast.PrefixExpression:
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.GroupedExpression:
+		return c.compile(node.Expression)
+	case *ast.InfixExpression:
+		return c.compileInfixExpression(node)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node, "")
+	case *ast.CallExpression:
+		if err := c.compile(node.Function); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.compile(a); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.ArrayLiteral:
+		for _, e := range node.Elements {
+			if err := c.compile(e); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		// in source order, which is the order of the keys in the hash
+		for _, p := range node.Pairs {
+			if err := c.compile(p.Key); err != nil {
+				return err
+			}
+			if err := c.compile(p.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.IndexExpression:
+		if err := c.compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+func (c *Compiler) compileInfixExpression(node *ast.InfixExpression) error {
+	if node.Operator == "&&" || node.Operator == "||" {
+		return c.compileLogicalExpression(node)
+	}
+
+	if err := c.compile(node.Left); err != nil {
+		return err
+	}
+	if err := c.compile(node.Right); err != nil {
+		return err
+	}
+
+	switch node.Operator {
+	case "+":
+		c.emit(code.OpAdd)
+	case "-":
+		c.emit(code.OpSub)
+	case "*":
+		c.emit(code.OpMul)
+	case "/":
+		c.emit(code.OpDiv)
+	case ">":
+		c.emit(code.OpGreaterThan)
+	case "<":
+		c.emit(code.OpLessThan)
+	case ">=":
+		c.emit(code.OpGreaterThanOrEqual)
+	case "<=":
+		c.emit(code.OpLessThanOrEqual)
+	case "==":
+		c.emit(code.OpEqual)
+	case "!=":
+		c.emit(code.OpNotEqual)
+	default:
+		return fmt.Errorf("unknown operator %s", node.Operator)
+	}
+
+	return nil
+}
+
+// <left> && <right> compiles to the equivalent of
+// if (<left>) { !!<right> } else { false }, and || to
+// if (<left>) { true } else { !!<right> }
+//
+//	<left>
+//	OpJumpNotTruthy alt
+//	OpTrue, or <right> OpBang OpBang
+//	OpJump end
+//	alt: <right> OpBang OpBang, or OpFalse
+//	end:
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	if err := c.compile(node.Left); err != nil {
+		return err
+	}
+
+	right := func() error {
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(code.OpBang)
+		c.emit(code.OpBang)
+		return nil
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if node.Operator == "&&" {
+		if err := right(); err != nil {
+			return err
+		}
+	} else {
+		c.emit(code.OpTrue)
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Operator == "&&" {
+		c.emit(code.OpFalse)
+	} else if err := right(); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// if (<cond>) { <cons> } else { <alt> } compiles to
+//
+//	<cond>
+//	OpJumpNotTruthy alt
+//	<cons>
+//	OpJump end
+//	alt: <alt> (or OpNull)
+//	end:
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+
+	// the jump targets are back-patched once they are known
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlockValue(node.Consequence); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(node.Alternative); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileBlockValue compiles a block used as an expression, leaving its value
+// on the stack rather than popping it
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+// compileFunctionLiteral emits the function as a closure, the values of its
+// free variables are pushed so that OpClosure can capture them. Within the
+// function, name (if given) refers to the closure itself.
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	if err := c.compile(node.Body); err != nil {
+		return err
+	}
+
+	// the value of the last expression is returned implicitly
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Parameters:    node.Parameters,
+		Body:          node.Body,
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
+	return nil
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit appends the instruction, returning its position
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+// what each operand of an instruction counts, for the error when one is too
+// large, and whether it's an index (which can be 0 to the largest operand)
+// rather than a number of things
+var operands = map[code.Opcode][]struct {
+	what  string
+	index bool
+}{
+	code.OpConstant:      {{"constants", true}},
+	code.OpJumpNotTruthy: {{"bytes of instructions in a function", true}},
+	code.OpJump:          {{"bytes of instructions in a function", true}},
+	code.OpGetGlobal:     {{"global bindings", true}},
+	code.OpSetGlobal:     {{"global bindings", true}},
+	code.OpGetLocal:      {{"local bindings in a function", true}},
+	code.OpSetLocal:      {{"local bindings in a function", true}},
+	code.OpCall:          {{"arguments in a call", false}},
+	code.OpArray:         {{"elements in an array", false}},
+	code.OpHash:          {{"keys and values in a hash", false}},
+	code.OpClosure:       {{"constants", true}, {"free variables in a function", false}},
+	code.OpGetFree:       {{"free variables in a function", true}},
+}
+
+// checkOperands keeps an error for the first operand which is too large
+// for its width, rather than letting code.Make truncate it
+func (c *Compiler) checkOperands(op code.Opcode, values ...int) {
+	if c.err != nil {
+		return
+	}
+
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		return
+	}
+
+	for i, v := range values {
+		max := code.MaxOperand(def.OperandWidths[i])
+		if v <= max {
+			continue
+		}
+
+		operand := operands[op][i]
+		if operand.index {
+			max++
+		}
+		c.err = fmt.Errorf("program too large: more than %d %s", max, operand.what)
+		return
+	}
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, operand)
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
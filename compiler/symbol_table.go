@@ -0,0 +1,139 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+)
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"     // a local of an enclosing function, captured by a closure
+	FunctionScope SymbolScope = "FUNCTION" // the name a function is bound to, within itself
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// the symbols of enclosing functions which this one refers to, in the
+	// order they are captured
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+// NewEnclosedSymbolTable creates the table for a function body
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+func (s *SymbolTable) Define(name string) Symbol {
+	existing, ok := s.store[name]
+	if ok && (existing.Scope == GlobalScope || existing.Scope == LocalScope) {
+		// rebinding a name reuses its slot
+		return existing
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: GlobalScope}
+	if s.Outer != nil {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// Copy gives a table with the same symbols, which can be defined in without
+// changing this one, i.e. to undo a compilation which failed
+func (s *SymbolTable) Copy() *SymbolTable {
+	c := &SymbolTable{
+		Outer:          s.Outer,
+		store:          make(map[string]Symbol, len(s.store)),
+		numDefinitions: s.numDefinitions,
+		FreeSymbols:    append([]Symbol(nil), s.FreeSymbols...),
+	}
+	for name, symbol := range s.store {
+		c.store[name] = symbol
+	}
+
+	return c
+}
+
+// DefineBuiltin binds name to the builtin at index, until a definition of the
+// same name shadows it
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName binds the name of the function being compiled, so that
+// it can call itself. Parameters and locals of the same name shadow it.
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, error) {
+	symbol, ok := s.store[name]
+	if ok {
+		return symbol, nil
+	}
+
+	if s.Outer == nil {
+		return symbol, fmt.Errorf("identifier not found: %s", name)
+	}
+
+	symbol, err := s.Outer.Resolve(name)
+	if err != nil {
+		return symbol, err
+	}
+
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, nil
+	}
+
+	// anything else lives in the frame of an enclosing function, so is
+	// copied into the closure when it's created
+	return s.defineFree(symbol), nil
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Symbols returns the symbols of this table, not its outer ones, ordered by
+// name
+func (s *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(s.store))
+	for _, symbol := range s.store {
+		symbols = append(symbols, symbol)
+	}
+
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Name < symbols[j].Name
+	})
+	return symbols
+}
@@ -0,0 +1,170 @@
+package compiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefineAndResolve(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	b := global.Define("b")
+
+	local := NewEnclosedSymbolTable(global)
+	c := local.Define("c")
+
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range []Symbol{a, b, c} {
+		if sym != expected[sym.Name] {
+			t.Errorf("expected %s to be %+v, got=%+v", sym.Name, expected[sym.Name], sym)
+		}
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		result, err := local.Resolve(name)
+		if err != nil {
+			t.Errorf("name %s not resolvable: %s", name, err)
+			continue
+		}
+		if result != expected[name] {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", name, expected[name], result)
+		}
+	}
+
+	if again := global.Define("a"); again != a {
+		t.Errorf("redefining a should reuse its slot. got=%+v", again)
+	}
+
+	if _, err := global.Resolve("c"); err == nil {
+		t.Errorf("expected local c not to be visible globally")
+	}
+}
+
+func TestDefineResolveBuiltins(t *testing.T) {
+	global := NewSymbolTable()
+	expected := []Symbol{
+		{Name: "a", Scope: BuiltinScope, Index: 0},
+		{Name: "c", Scope: BuiltinScope, Index: 1},
+	}
+	for i, sym := range expected {
+		global.DefineBuiltin(i, sym.Name)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	for _, table := range []*SymbolTable{global, local} {
+		for _, sym := range expected {
+			result, err := table.Resolve(sym.Name)
+			if err != nil {
+				t.Errorf("name %s not resolvable: %s", sym.Name, err)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+	}
+
+	// a definition shadows the builtin, taking a slot of its own
+	shadow := global.Define("a")
+	if want := (Symbol{Name: "a", Scope: GlobalScope, Index: 0}); shadow != want {
+		t.Errorf("expected %+v, got=%+v", want, shadow)
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	first := NewEnclosedSymbolTable(global)
+	first.Define("b")
+
+	second := NewEnclosedSymbolTable(first)
+	second.Define("c")
+
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: FreeScope, Index: 0},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+	}
+
+	for name, want := range expected {
+		result, err := second.Resolve(name)
+		if err != nil {
+			t.Errorf("name %s not resolvable: %s", name, err)
+			continue
+		}
+		if result != want {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", name, want, result)
+		}
+	}
+
+	free := []Symbol{{Name: "b", Scope: LocalScope, Index: 0}}
+	if len(second.FreeSymbols) != 1 || second.FreeSymbols[0] != free[0] {
+		t.Errorf("expected free symbols %+v, got=%+v", free, second.FreeSymbols)
+	}
+
+	// a local of the same name replaces the free variable
+	if d := second.Define("b"); d != (Symbol{Name: "b", Scope: LocalScope, Index: 1}) {
+		t.Errorf("expected b to be redefined as a local, got=%+v", d)
+	}
+}
+
+func TestDefineFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	fn := NewEnclosedSymbolTable(global)
+	fn.DefineFunctionName("f")
+
+	if result, err := fn.Resolve("f"); err != nil || result != (Symbol{Name: "f", Scope: FunctionScope, Index: 0}) {
+		t.Errorf("expected f to resolve to the function, got=%+v (%v)", result, err)
+	}
+
+	// a parameter of the same name shadows it
+	if p := fn.Define("f"); p != (Symbol{Name: "f", Scope: LocalScope, Index: 0}) {
+		t.Errorf("expected f to be redefined as a local, got=%+v", p)
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("b")
+	global.Define("a")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("c")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 1},
+		{Name: "b", Scope: GlobalScope, Index: 0},
+		{Name: "len", Scope: BuiltinScope, Index: 0},
+	}
+
+	if actual := global.Symbols(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got=%+v", expected, actual)
+	}
+	if actual := local.Symbols(); len(actual) != 1 || actual[0].Name != "c" {
+		t.Errorf("expected only c in the local table, got=%+v", actual)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	c := global.Copy()
+	if b := c.Define("b"); b.Index != 1 {
+		t.Errorf("expected b to be defined after a, got=%+v", b)
+	}
+
+	if _, err := global.Resolve("b"); err == nil {
+		t.Errorf("expected b not to be defined in the original")
+	}
+	if a := global.Define("c"); a.Index != 1 {
+		t.Errorf("expected the original to carry on from a, got=%+v", a)
+	}
+}
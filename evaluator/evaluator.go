@@ -0,0 +1,540 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sscaling/monkey/ast"
+	"github.com/sscaling/monkey/object"
+)
+
+// there is only ever one instance of each of these, so they can be compared by reference
+var (
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+)
+
+// Eval evaluates node without any limits
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return EvalWithContext(nil, node, env)
+}
+
+// EvalWithContext evaluates node, stopping with an *object.LimitError once
+// it exceeds the limits of ec
+func EvalWithContext(ec *object.EvalContext, node ast.Node, env *object.Environment) object.Object {
+	return eval(orUnlimited(ec), node, env)
+}
+
+// ApplyWithContext calls fn, a function or builtin, with args as a call
+// expression would. ec can be nil for no limits.
+func ApplyWithContext(ec *object.EvalContext, fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(orUnlimited(ec), fn, args...)
+}
+
+// orUnlimited gives ec, or one without limits if it's nil, which still
+// counts the depth of calls to stop at object.MaxCallDepth
+func orUnlimited(ec *object.EvalContext) *object.EvalContext {
+	if ec == nil {
+		return object.NewEvalContext(context.Background(), object.Limits{})
+	}
+
+	return ec
+}
+
+func eval(ec *object.EvalContext, node ast.Node, env *object.Environment) object.Object {
+	if err := ec.Step(); err != nil {
+		return err
+	}
+
+	switch node := node.(type) {
+
+	// statements
+	case *ast.Program:
+		return evalProgram(ec, node, env)
+	case *ast.ExpressionStatement:
+		return eval(ec, node.Expression, env)
+	case *ast.BlockStatement:
+		return evalBlockStatement(ec, node, env)
+	case *ast.LetStatement:
+		val := eval(ec, node.Value, env)
+		if isError(val) {
+			return val
+		}
+		env.Set(node.Name.Value, val)
+	case *ast.ReturnStatement:
+		val := eval(ec, node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	// expressions
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+	case *ast.PrefixExpression:
+		right := eval(ec, node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalPrefixExpression(node.Operator, right)
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(ec, node, env)
+		}
+		left := eval(ec, node.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := eval(ec, node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return allocated(ec, evalInfixExpression(node.Operator, left, right))
+	case *ast.GroupedExpression:
+		return eval(ec, node.Expression, env)
+	case *ast.IfExpression:
+		return evalIfExpression(ec, node, env)
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+	case *ast.CallExpression:
+		function := eval(ec, node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpressions(ec, node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return applyFunction(ec, function, args...)
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(ec, node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return allocated(ec, &object.Array{Elements: elements})
+	case *ast.HashLiteral:
+		return allocated(ec, evalHashLiteral(ec, node, env))
+	case *ast.IndexExpression:
+		left := eval(ec, node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := eval(ec, node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+	}
+
+	return nil
+}
+
+func evalProgram(ec *object.EvalContext, program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, s := range program.Statements {
+		result = eval(ec, s, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error, *object.LimitError:
+			return result
+		}
+	}
+
+	return result
+}
+
+// unlike evalProgram, a return value is passed up still wrapped so that any
+// enclosing blocks also stop evaluating
+func evalBlockStatement(ec *object.EvalContext, block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, s := range block.Statements {
+		result = eval(ec, s, env)
+
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+func evalIfExpression(ec *object.EvalContext, ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := eval(ec, ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	var result object.Object
+	if isTruthy(condition) {
+		result = eval(ec, ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		result = eval(ec, ie.Alternative, env)
+	}
+
+	// an empty block, or one ending with a let statement, has no value
+	if result == nil {
+		return NULL
+	}
+
+	return result
+}
+
+// evalExpressions evaluates left to right, returning just the error if one occurs
+func evalExpressions(ec *object.EvalContext, exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		evaluated := eval(ec, e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+func applyFunction(ec *object.EvalContext, fn object.Object, args ...object.Object) object.Object {
+	if builtin, ok := fn.(*object.Builtin); ok {
+		call := func(fn object.Object, args ...object.Object) object.Object {
+			return applyFunction(ec, fn, args...)
+		}
+		return allocated(ec, builtin.Call(call, args...))
+	}
+
+	function, ok := fn.(*object.Function)
+	if !ok {
+		return newError("not a function: %s", fn.Type())
+	}
+
+	if len(args) != len(function.Parameters) {
+		return newError("wrong number of arguments: want=%d, got=%d", len(function.Parameters), len(args))
+	}
+
+	if ec.Depth() >= object.MaxCallDepth {
+		return &object.LimitError{Limit: object.LimitDepth, Max: object.MaxCallDepth}
+	}
+
+	if err := ec.Enter(); err != nil {
+		return err
+	}
+	defer ec.Leave()
+
+	env := object.NewEnclosedEnvironment(function.Env)
+	for i, param := range function.Parameters {
+		env.Set(param.Value, args[i])
+	}
+
+	evaluated := eval(ec, function.Body, env)
+
+	// unwrap, otherwise the return would also stop evaluation of the caller
+	if returnValue, ok := evaluated.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+	if evaluated == nil {
+		return NULL
+	}
+
+	return evaluated
+}
+
+// allocated counts the size of a new string, array or hash against the
+// allocation limit, a builtin's result is counted in full
+func allocated(ec *object.EvalContext, obj object.Object) object.Object {
+	if err := ec.Alloc(obj); err != nil {
+		return err
+	}
+
+	return obj
+}
+
+// a binding shadows a builtin of the same name
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+
+	if builtin := object.Builtins.Lookup(node.Value); builtin != nil {
+		return builtin
+	}
+
+	return newError("identifier not found: %s", node.Value)
+}
+
+func evalHashLiteral(ec *object.EvalContext, node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range node.Pairs {
+		key := eval(ec, pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := eval(ec, pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash
+}
+
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		return evalArrayIndexExpression(left, index)
+	case *object.Hash:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// an index outside the array, including a negative one, gives null
+func evalArrayIndexExpression(arr *object.Array, index object.Object) object.Object {
+	i, ok := index.(*object.Integer)
+	if !ok {
+		return newError("array index must be INTEGER, got %s", index.Type())
+	}
+
+	if i.Value < 0 || i.Value >= int64(len(arr.Elements)) {
+		return NULL
+	}
+
+	return arr.Elements[i.Value]
+}
+
+// a key which isn't set gives null
+func evalHashIndexExpression(hash *object.Hash, index object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	if value, ok := hash.Get(key); ok {
+		return value
+	}
+
+	return NULL
+}
+
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(right)
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+// !<expr> is true only for false and null, everything else is 'truthy'
+func evalBangOperatorExpression(right object.Object) object.Object {
+	switch right {
+	case FALSE, NULL:
+		return TRUE
+	default:
+		return FALSE
+	}
+}
+
+func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newError("unknown operator: -%s", right.Type())
+	}
+}
+
+func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		// at least one is a float, the other is promoted
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	// booleans and null are singletons, so pointer comparison is enough
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalLogicalExpression evaluates && and ||, which only evaluate the right
+// operand when the left doesn't decide the result. Either way it's a boolean.
+func evalLogicalExpression(ec *object.EvalContext, node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := eval(ec, node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if isTruthy(left) == (node.Operator == "||") {
+		return nativeBoolToBooleanObject(isTruthy(left))
+	}
+
+	right := eval(ec, node.Right, env)
+	if isError(right) {
+		return right
+	}
+
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	l := left.(*object.Integer).Value
+	r := right.(*object.Integer).Value
+
+	switch operator {
+	case "+":
+		return &object.Integer{Value: l + r}
+	case "-":
+		return &object.Integer{Value: l - r}
+	case "*":
+		return &object.Integer{Value: l * r}
+	case "/":
+		if r == 0 {
+			return newError("division by zero: %d / %d", l, r)
+		}
+		return &object.Integer{Value: l / r}
+	case "<":
+		return nativeBoolToBooleanObject(l < r)
+	case ">":
+		return nativeBoolToBooleanObject(l > r)
+	case "<=":
+		return nativeBoolToBooleanObject(l <= r)
+	case ">=":
+		return nativeBoolToBooleanObject(l >= r)
+	case "==":
+		return nativeBoolToBooleanObject(l == r)
+	case "!=":
+		return nativeBoolToBooleanObject(l != r)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	l := toFloat(left)
+	r := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: l + r}
+	case "-":
+		return &object.Float{Value: l - r}
+	case "*":
+		return &object.Float{Value: l * r}
+	case "/":
+		if r == 0 {
+			return newError("division by zero: %s / %s", left.Inspect(), right.Inspect())
+		}
+		return &object.Float{Value: l / r}
+	case "<":
+		return nativeBoolToBooleanObject(l < r)
+	case ">":
+		return nativeBoolToBooleanObject(l > r)
+	case "<=":
+		return nativeBoolToBooleanObject(l <= r)
+	case ">=":
+		return nativeBoolToBooleanObject(l >= r)
+	case "==":
+		return nativeBoolToBooleanObject(l == r)
+	case "!=":
+		return nativeBoolToBooleanObject(l != r)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat gives the value of an Integer or Float as a float64
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+
+	return obj.(*object.Float).Value
+}
+
+// null and false are the only falsy values
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL, FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	l := left.(*object.String).Value
+	r := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: l + r}
+	case "==":
+		return nativeBoolToBooleanObject(l == r)
+	case "!=":
+		return nativeBoolToBooleanObject(l != r)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func nativeBoolToBooleanObject(b bool) *object.Boolean {
+	if b {
+		return TRUE
+	}
+
+	return FALSE
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+
+	return false
+}
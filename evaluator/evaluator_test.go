@@ -0,0 +1,695 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sscaling/monkey/ast"
+	"github.com/sscaling/monkey/lexer"
+	"github.com/sscaling/monkey/object"
+	"github.com/sscaling/monkey/parser"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * 2 * 2 * 2 * 2 / 4", 8},
+		{"0xFF + 0o17 + 0b11 + 1_000", 1273},
+		{"010", 8},
+		{"0x7FFF_FFFF_FFFF_FFFF", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"3.14", "3.14"},
+		{"-2.5", "-2.5"},
+		{"1e-9", "1e-09"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+		{"1.5 * 2", "3.0"},
+		{"2 * 1.5", "3.0"},
+		{"7 / 2.0", "3.5"},
+		{"1 - 0.5 - 0.5", "0.0"},
+		{"2.5 > 2", "true"},
+		{"2 <= 1.5", "false"},
+		{"1 == 1.0", "true"},
+		{"1.0 != 1", "false"},
+		{"1.5 / 0", "ERROR: division by zero: 1.5 / 0"},
+		{"-true + 1.5", "ERROR: unknown operator: -BOOLEAN"},
+		{"1.5 + true", "ERROR: type mismatch: FLOAT + BOOLEAN"},
+		{`"a" + 1.5`, "ERROR: type mismatch: STRING + FLOAT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", true == false},
+		{"let a = 1 < 2; let b = 2 > 1; a == b", true},
+		{"let a = 1 < 2; let b = 2 > 1; a != b", false},
+		{"let a = 1 > 2; let b = 2 > 1; a == b", false},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"true && 1 < 2", true},
+		{"true && false", false},
+		{"false || 1 >= 1", true},
+		{"false || false", false},
+		{"1 && \"a\"", true},
+		{"if (false) { 1 } || false", false},
+		{"1 < 2 && 2 < 3 || false", true},
+		// the right operand isn't evaluated when the left decides it
+		{"false && missing", false},
+		{"true || 1 / 0", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalBooleanLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"true == true", true},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"(1 > 2) == true", false},
+		{"!true", false},
+		{"!!false", false},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) { }", nil},
+		{"if (true) { let x = 1 }", nil},
+		{"if (false) { 1 } else { let x = 1; }", nil},
+		{"let f = fn() { if (true) { let x = 1 } }; f()", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestNestedReturnStatements(t *testing.T) {
+	input := `
+	if (10 > 1) {
+		if (10 > 1) {
+			return 10;
+		}
+
+		return 1;
+	}`
+
+	testIntegerObject(t, testEval(t, input), 10)
+}
+
+func TestFunctionObject(t *testing.T) {
+	evaluated := testEval(t, "fn(x) { x + 2; };")
+
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	if fn.Body.String() != "(x + 2)" {
+		t.Fatalf("body is not %q. got=%q", "(x + 2)", fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let f = fn() { return 1; 2 }; f() + 10", 11},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(3)", 5},
+		{"let add = fn(x) { fn(y) { fn(z) { x + y + z } } }; add(1)(2)(3)", 6},
+		{"let compose = fn(f, g) { fn(x) { g(f(x)) } }; compose(fn(x) { x + 1 }, fn(x) { x * 2 })(3)", 8},
+		{"let apply = fn(f, x) { f(x) }; apply(fn(x) { x * x }, 4)", 16},
+		{"let wrapper = fn() { let countDown = fn(x) { if (x == 0) { 0 } else { countDown(x - 1) } }; countDown(5) }; wrapper()", 0},
+		{"let x = 1; let f = fn() { x }; let g = fn(x) { f() }; g(2)", 1},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"Hello World!"`, "Hello World!"},
+		{`"Hello" + " " + "World!"`, "Hello World!"},
+		{`let greet = fn(name) { "Hello, " + name }; greet("\u{1F435}")`, "Hello, 🐵"},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" == "b"`, false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. got=%q, expected=%q", str.Value, expected)
+			}
+		}
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let a = 1 < 2; !a", false},
+		{"let a = 1 > 2; !a", true},
+		{"!5", false},
+		{"let a = 1 < 2; !!a", true},
+		{"!!5", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let t = 1 < 2; 5 + t;", "type mismatch: INTEGER + BOOLEAN"},
+		{"let t = 1 < 2; 5 + t; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"let t = 1 < 2; -t", "unknown operator: -BOOLEAN"},
+		{"let t = 1 < 2; t + t;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"let t = 1 < 2; 5; t * t; 5", "unknown operator: BOOLEAN * BOOLEAN"},
+		{"let t = 1 < 2; return -t; 5", "unknown operator: -BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{"let a = 1 / 0; a", "division by zero: 1 / 0"},
+		{"(if (true) { let x = 1 }) + 1", "type mismatch: NULL + INTEGER"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { if (10 > 1) { return true + false; } return 1; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"5(1)", "not a function: INTEGER"},
+		{"fn(x) { x }(1, 2)", "wrong number of arguments: want=1, got=2"},
+		{"fn(x) { x }(y)", "identifier not found: y"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{`"Hello" + 1`, "type mismatch: STRING + INTEGER"},
+		{"1[0]", "index operator not supported: INTEGER"},
+		{`[1][true]`, "array index must be INTEGER, got BOOLEAN"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{`{1: 2 + true}`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	evaluated := testEval(t, "[1, 2 * 2, 3 + 3]")
+
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[[1, 2], [3]][0][1]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+		{"[][0]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("héllo")`, 5},
+		{`len([1, 2, 3])`, 3},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments: want=1, got=2"},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`rest([1, 2, 3])`, []int64{2, 3}},
+		{`rest([1])`, []int64{}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int64{1}},
+		{`let a = [1]; push(a, 2); a`, []int64{1}},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int64{2, 4, 6}},
+		{`map([], fn(x) { x })`, []int64{}},
+		{`map([1], 1)`, "not a function: INTEGER"},
+		{`map([1, 2], fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, []int64{3, 4}},
+		{`filter([1, 2], fn(x) { if (x == 1) { 1 } })`, []int64{1}},
+		{`reduce([1, 2, 3], 0, fn(acc, x) { acc + x })`, 6},
+		{`reduce([], 10, fn(acc, x) { acc + x })`, 10},
+		{`reduce([1], 0, fn(x) { x })`, "wrong number of arguments: want=1, got=2"},
+		{`let len = fn(x) { 42 }; len([])`, 42},
+		{`reduce(map([1, 2, 3], fn(x) { [x] }), 0, fn(acc, x) { acc + first(x) })`, 6},
+		{`len({1: 2, 3: 4})`, 2},
+		{`keys({"b": 1, "a": 2, 3: 3})`, "[b, a, 3]"},
+		{`values({"b": 1, "a": 2})`, "[1, 2]"},
+		{`keys({})`, "[]"},
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`has({"a": 1}, [])`, "unusable as hash key: ARRAY"},
+		{`let h = {"a": 1, "b": 2, "c": 3}; delete(h, "b")`, "{a: 1, c: 3}"},
+		{`let h = {"a": 1}; delete(h, "a"); h`, "{a: 1}"},
+		{`delete({"a": 1}, "z")`, "{a: 1}"},
+		{`keys([1])`, "argument to `keys` must be HASH, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			// an error message, or the output of a hash or array of other types
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+				}
+			} else if evaluated.Inspect() != expected {
+				t.Errorf("%s: expected %s, got %T (%s)", tt.input, expected, evaluated, evaluated.Inspect())
+			}
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("%s: object is not Array. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("%s: wrong num of elements. want=%d, got=%d", tt.input, len(expected), len(array.Elements))
+				continue
+			}
+			for i, e := range expected {
+				testIntegerObject(t, array.Elements[i], e)
+			}
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6,
+		"one": 7
+	}`
+
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	// a repeated key keeps its first place, with the last value
+	expected := `{one: 7, two: 2, three: 3, 4: 4, true: 5, false: 6}`
+	if result.Inspect() != expected {
+		t.Errorf("expected %s, got %s", expected, result.Inspect())
+	}
+
+	if result.Len() != 6 {
+		t.Errorf("hash has wrong num of pairs. got=%d", result.Len())
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{1: 5}[true]`, nil},
+		{`{"1": 5}[1]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestPutsBlockValue(t *testing.T) {
+	var out bytes.Buffer
+	object.Builtins.Out = &out
+	defer func() { object.Builtins.Out = os.Stdout }()
+
+	testNullObject(t, testEval(t, "puts(if (true) { let x = 1 })"))
+
+	if out.String() != "null\n" {
+		t.Errorf("expected puts to write null, got %q", out.String())
+	}
+}
+
+func TestHostBuiltins(t *testing.T) {
+	err := object.Builtins.RegisterFunc("evalTestSplit", strings.Split)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`evalTestSplit("a,b", ",")`, "[a, b]"},
+		{`evalTestSplit("a,b")`, "ERROR: wrong number of arguments: want=2, got=1"},
+		{`evalTestSplit(1, ",")`, "ERROR: argument 1 to `evalTestSplit`: cannot use INTEGER as string"},
+		{`let evalTestSplit = fn(s, sep) { s }; evalTestSplit("a,b", ",")`, "a,b"},
+		{`type(evalTestSplit)`, "BUILTIN"},
+		{`type(fn() {})`, "FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		if actual := testEval(t, tt.input).Inspect(); actual != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		input    string
+		ctx      context.Context
+		limits   object.Limits
+		expected object.Limit
+	}{
+		{"let f = fn(x) { f(x) }; f(1)", nil, object.Limits{MaxSteps: 1000}, object.LimitSteps},
+		{"map([1, 2, 3], fn(x) { let f = fn() { f() }; f() })", nil, object.Limits{MaxSteps: 1000}, object.LimitSteps},
+		{"let f = fn(x) { f(x + 1) }; f(0)", nil, object.Limits{MaxDepth: 100}, object.LimitDepth},
+		{"let f = fn() { f() }; f()", nil, object.Limits{}, object.LimitDepth},
+		{"let f = fn() { f() }; f()", nil, object.Limits{MaxDepth: 2 * object.MaxCallDepth}, object.LimitDepth},
+		{`let grow = fn(s) { grow(s + s) }; grow("ab")`, nil, object.Limits{MaxAlloc: 1 << 20}, object.LimitAlloc},
+		{"let grow = fn(a) { grow(push(a, a)) }; grow([])", nil, object.Limits{MaxAlloc: 10000}, object.LimitAlloc},
+		{"[1, 2, 3]", cancelled, object.Limits{}, object.LimitContext},
+	}
+
+	for _, tt := range tests {
+		ec := object.NewEvalContext(tt.ctx, tt.limits)
+		result := EvalWithContext(ec, parse(t, tt.input), object.NewEnvironment())
+
+		err, ok := result.(*object.LimitError)
+		if !ok {
+			t.Errorf("%q: expected a limit error, got %T (%+v)", tt.input, result, result)
+			continue
+		}
+		if err.Limit != tt.expected {
+			t.Errorf("%q: expected the %s limit, got %s", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestLimitsTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// never returns in practice, but doesn't recurse deeply
+	input := "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; f(50)"
+
+	result := EvalWithContext(object.NewEvalContext(ctx, object.Limits{}), parse(t, input), object.NewEnvironment())
+
+	err, ok := result.(*object.LimitError)
+	if !ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to be exceeded, got %T (%+v)", result, result)
+	}
+}
+
+func TestWithinLimits(t *testing.T) {
+	ec := object.NewEvalContext(context.Background(), object.Limits{MaxSteps: 10000, MaxDepth: 20, MaxAlloc: 1000})
+	input := "let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(10)"
+
+	testIntegerObject(t, EvalWithContext(ec, parse(t, input), object.NewEnvironment()), 3628800)
+
+	if ec.Steps() == 0 {
+		t.Errorf("expected the steps to be counted")
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser has %d errors for %q: %v", len(errs), input, errs)
+	}
+
+	return program
+}
+
+func testEval(t *testing.T, input string) object.Object {
+	return Eval(parse(t, input), object.NewEnvironment())
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, expected=%d", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, expected=%t", result.Value, expected)
+		return false
+	}
+
+	return true
+}
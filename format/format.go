@@ -0,0 +1,547 @@
+// Package format prints Monkey programs in a canonical style: one statement
+// per line, blocks indented with tabs and only the parentheses the grouping
+// needs. Comments are kept, along with single blank lines between statements.
+// Formatting already formatted source leaves it unchanged.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/sscaling/monkey/ast"
+	"github.com/sscaling/monkey/lexer"
+	"github.com/sscaling/monkey/parser"
+	"github.com/sscaling/monkey/token"
+)
+
+// Error is returned when the source to format doesn't parse
+type Error struct {
+	Errors []*parser.ParseError
+}
+
+func (e *Error) Error() string {
+	msgs := []string{}
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Source formats a program
+func Source(src string) (string, error) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", src)
+
+	p := parser.New(lexer.NewFile(file, lexer.WithComments()))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", &Error{Errors: p.Errors()}
+	}
+
+	pr := &printer{file: file, comments: ast.NewCommentMap(file, program)}
+	pr.program(program)
+
+	return pr.out.String(), nil
+}
+
+// Node writes the canonical form of node to w. Without the source there is
+// no way to know where the comments and blank lines were, so none are written.
+func Node(w io.Writer, node ast.Node) error {
+	pr := &printer{}
+
+	switch n := node.(type) {
+	case *ast.Program:
+		pr.program(n)
+	case ast.Statement:
+		pr.statements(n, []ast.Statement{n})
+	case ast.Expression:
+		pr.expression(n, parser.LOWEST)
+	default:
+		return fmt.Errorf("format: unexpected node type %T", node)
+	}
+
+	_, err := w.Write(pr.out.Bytes())
+	return err
+}
+
+type printer struct {
+	out    bytes.Buffer
+	indent int
+
+	file     *token.File // nil when formatting a node without its source
+	comments ast.CommentMap
+
+	// comments within the statement being printed, in order, which are
+	// printed before the token they precede
+	pending []*ast.Comment
+}
+
+func (p *printer) print(s string) {
+	p.out.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.out.WriteByte('\n')
+	p.out.WriteString(strings.Repeat("\t", p.indent))
+}
+
+func (p *printer) program(program *ast.Program) {
+	p.statements(program, program.Statements)
+	if p.out.Len() > 0 {
+		p.print("\n")
+	}
+}
+
+// statements prints the statements of owner, each on its own line along with
+// their comments
+func (p *printer) statements(owner ast.Node, list []ast.Statement) {
+	last := token.NoPos // where the last thing printed ended
+	block, isBlock := owner.(*ast.BlockStatement)
+
+	// next starts the line for something from pos to end
+	next := func(pos, end token.Pos) {
+		switch {
+		case last.IsValid():
+			p.newline()
+			if p.blankLineBetween(last, pos) {
+				// no trailing tabs on the blank line
+				p.out.Truncate(p.out.Len() - p.indent)
+				p.newline()
+			}
+		case isBlock:
+			p.newline()
+		}
+		last = end
+	}
+
+	// afterBrace prints c on the line of the block's {, if that's where it was
+	afterBrace := func(c *ast.Comment) bool {
+		if last.IsValid() || !isBlock || p.line(c.Pos()) != p.line(block.Pos()) {
+			return false
+		}
+		p.print(" " + c.Token.Literal)
+		last = c.End()
+		return true
+	}
+
+	for i, s := range list {
+		leading, inner, trailing := p.split(s)
+
+		inline := false // the last leading comment is on the line of s
+		for _, c := range leading {
+			if afterBrace(c) {
+				continue
+			}
+
+			next(c.Pos(), c.End())
+			p.print(c.Token.Literal)
+			inline = !isLineComment(c) && p.line(c.End()) == p.line(s.Pos())
+		}
+
+		if inline {
+			p.print(" ")
+			last = s.End()
+		} else {
+			next(s.Pos(), s.End())
+		}
+
+		saved := p.pending
+		p.pending = inner
+		var following ast.Statement
+		if i+1 < len(list) {
+			following = list[i+1]
+		}
+		p.statement(s, following)
+		// those which weren't before a token, and the trailing comments
+		rest := append(p.pending, trailing...)
+		for j, c := range rest {
+			if j > 0 && isLineComment(rest[j-1]) {
+				p.newline()
+			} else {
+				p.print(" ")
+			}
+			p.print(c.Token.Literal)
+			last = c.End()
+		}
+		p.pending = saved
+	}
+
+	for _, c := range p.comments[owner] {
+		if afterBrace(c) {
+			continue
+		}
+		next(c.Pos(), c.End())
+		p.print(c.Token.Literal)
+	}
+}
+
+// split gives the comments before s, those within it and those after it
+func (p *printer) split(s ast.Statement) (leading, inner, trailing []*ast.Comment) {
+	for _, c := range p.comments[s] {
+		switch {
+		case c.Pos() >= s.End():
+			trailing = append(trailing, c)
+		case c.Pos() < s.Pos():
+			leading = append(leading, c)
+		default:
+			inner = append(inner, c)
+		}
+	}
+
+	return leading, inner, trailing
+}
+
+func isLineComment(c *ast.Comment) bool {
+	return strings.HasPrefix(c.Token.Literal, "//")
+}
+
+func (p *printer) blankLineBetween(end, pos token.Pos) bool {
+	if p.file == nil {
+		return false
+	}
+
+	return p.line(pos)-p.line(end) > 1
+}
+
+func (p *printer) line(pos token.Pos) int {
+	return p.file.Position(pos).Line
+}
+
+// statement prints s, where following is the statement after it, if any
+func (p *printer) statement(s ast.Statement, following ast.Statement) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.print("let ")
+		p.print(s.Name.Value)
+		p.print(" = ")
+		p.expression(s.Value, parser.LOWEST)
+		p.print(";")
+	case *ast.ReturnStatement:
+		p.print("return ")
+		p.expression(s.Value, parser.LOWEST)
+		p.print(";")
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression, parser.LOWEST)
+		// an if reads as a statement in its own right, without a ;, unless
+		// the statement after it would carry on the expression instead
+		if _, ok := unparen(s.Expression).(*ast.IfExpression); !ok || continues(following) {
+			p.print(";")
+		}
+	case *ast.BlockStatement:
+		p.block(s)
+	default:
+		panic(fmt.Sprintf("format: unexpected statement type %T", s))
+	}
+}
+
+func (p *printer) block(b *ast.BlockStatement) {
+	if len(b.Statements) == 0 && len(p.comments[b]) == 0 {
+		p.print("{}")
+		return
+	}
+
+	p.print("{")
+	p.indent++
+	p.statements(b, b.Statements)
+	p.indent--
+	p.newline()
+	p.print("}")
+}
+
+// expression prints e within an expression binding at precedence, adding
+// parentheses if e binds less tightly than that
+func (p *printer) expression(e ast.Expression, precedence int) {
+	e = unparen(e)
+	p.leading(e.Pos())
+
+	if precedence > binding(e) {
+		p.print("(")
+		p.expression(e, parser.LOWEST)
+		p.print(")")
+		return
+	}
+
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.print(e.Value)
+	case *ast.IntegerLiteral:
+		p.print(e.Token.Literal)
+	case *ast.FloatLiteral:
+		p.print(e.Token.Literal)
+	case *ast.StringLiteral:
+		p.print(quote(e.Value))
+	case *ast.Boolean:
+		p.print(fmt.Sprintf("%t", e.Value))
+	case *ast.PrefixExpression:
+		p.print(e.Operator)
+		if right, ok := unparen(e.Right).(*ast.PrefixExpression); ok && right.Operator == "-" && e.Operator == "-" {
+			// rather than --x
+			p.print("(")
+			p.expression(right, parser.LOWEST)
+			p.print(")")
+		} else {
+			p.expression(e.Right, parser.PREFIX)
+		}
+	case *ast.InfixExpression:
+		// operators are left associative, so only the right needs
+		// parentheses at the same precedence
+		prec := binding(e)
+		p.expression(e.Left, prec)
+		p.trailing(token.Pos(e.Token.Position))
+		p.space()
+		p.print(e.Operator + " ")
+		p.expression(e.Right, prec+1)
+	case *ast.IfExpression:
+		p.print("if (")
+		p.expression(e.Condition, parser.LOWEST)
+		p.closing(e.Consequence.Pos(), ") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.print(" else ")
+			p.block(e.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		p.print("fn(")
+		for i, param := range e.Parameters {
+			if i > 0 {
+				p.separator(e.Parameters[i-1].End())
+			}
+			p.expression(param, parser.LOWEST)
+		}
+		p.closing(e.Body.Pos(), ") ")
+		p.block(e.Body)
+	case *ast.CallExpression:
+		p.expression(e.Function, parser.CALL)
+		p.trailing(token.Pos(e.Token.Position))
+		p.print("(")
+		for i, a := range e.Arguments {
+			if i > 0 {
+				p.separator(e.Arguments[i-1].End())
+			}
+			p.expression(a, parser.LOWEST)
+		}
+		p.closing(e.Rparen, ")")
+	case *ast.ArrayLiteral:
+		p.print("[")
+		for i, el := range e.Elements {
+			if i > 0 {
+				p.separator(e.Elements[i-1].End())
+			}
+			p.expression(el, parser.LOWEST)
+		}
+		p.closing(e.Rbracket, "]")
+	case *ast.HashLiteral:
+		p.print("{")
+		for i, pair := range e.Pairs {
+			if i > 0 {
+				p.separator(e.Pairs[i-1].Value.End())
+			}
+			p.expression(pair.Key, parser.LOWEST)
+			p.trailing(p.tokenAfter(pair.Key.End()))
+			p.print(": ")
+			p.expression(pair.Value, parser.LOWEST)
+		}
+		p.closing(e.Rbrace, "}")
+	case *ast.IndexExpression:
+		p.expression(e.Left, parser.INDEX)
+		p.trailing(token.Pos(e.Token.Position))
+		p.print("[")
+		p.expression(e.Index, parser.LOWEST)
+		p.closing(e.Rbracket, "]")
+	default:
+		panic(fmt.Sprintf("format: unexpected expression type %T", e))
+	}
+}
+
+// leading prints the pending comments which come before pos, where an
+// expression is about to be printed
+func (p *printer) leading(pos token.Pos) {
+	for len(p.pending) > 0 && p.pending[0].End() <= pos {
+		c := p.pending[0]
+		p.pending = p.pending[1:]
+
+		p.print(c.Token.Literal)
+		if isLineComment(c) {
+			p.continueLine()
+		} else {
+			p.print(" ")
+		}
+	}
+}
+
+// trailing prints the pending comments which come before pos, the position
+// of the token about to be printed, after what's been printed so far
+func (p *printer) trailing(pos token.Pos) {
+	for len(p.pending) > 0 && p.pending[0].End() <= pos {
+		c := p.pending[0]
+		p.pending = p.pending[1:]
+
+		p.space()
+		p.print(c.Token.Literal)
+		if isLineComment(c) {
+			p.continueLine()
+		}
+	}
+}
+
+// closing prints the pending comments before pos, and then the bracket
+// there, back at the indent of the statement if a // comment came before it
+func (p *printer) closing(pos token.Pos, bracket string) {
+	p.trailing(pos)
+	if bytes.HasSuffix(p.out.Bytes(), []byte(strings.Repeat("\t", p.indent+1))) {
+		p.out.Truncate(p.out.Len() - 1)
+	}
+	p.print(bracket)
+}
+
+// space prints a space, unless a line or a bracket has just been started
+func (p *printer) space() {
+	if b := p.out.Bytes(); len(b) > 0 && !strings.ContainsRune("\t\n([{", rune(b[len(b)-1])) {
+		p.print(" ")
+	}
+}
+
+// separator prints the pending comments before the , after an element of a
+// list ending at end
+func (p *printer) separator(end token.Pos) {
+	p.trailing(p.tokenAfter(end))
+	p.print(", ")
+}
+
+// continueLine starts a new line within an expression, after a // comment,
+// indented to show it carries on the line before
+func (p *printer) continueLine() {
+	p.indent++
+	p.newline()
+	p.indent--
+}
+
+// tokenAfter gives the position of the first token after pos, skipping space
+// and comments. It's used for the tokens which the tree doesn't record the
+// positions of, so is only needed when there are comments to place.
+func (p *printer) tokenAfter(pos token.Pos) token.Pos {
+	if len(p.pending) == 0 {
+		return pos
+	}
+
+	src := p.file.Source()
+	i := p.file.Offset(pos)
+	for i < len(src) {
+		switch {
+		case src[i] == ' ' || src[i] == '\t' || src[i] == '\n' || src[i] == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"), strings.HasPrefix(src[i:], "/*"):
+			c := p.comment(p.file.Pos(i))
+			if c == nil {
+				return p.file.Pos(i)
+			}
+			i = p.file.Offset(c.End())
+		default:
+			return p.file.Pos(i)
+		}
+	}
+
+	return p.file.Pos(i)
+}
+
+// comment gives the pending comment starting at pos, if there is one
+func (p *printer) comment(pos token.Pos) *ast.Comment {
+	for _, c := range p.pending {
+		if c.Pos() == pos {
+			return c
+		}
+	}
+	return nil
+}
+
+// continues is whether s starts with a token which would carry on an
+// expression before it, i.e. the - of an infix, the ( of a call or the [ of
+// an index
+func continues(s ast.Statement) bool {
+	es, ok := s.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+
+	return startsInfix(es.Expression, parser.LOWEST)
+}
+
+// startsInfix is whether e, printed within an expression binding at
+// precedence, starts with a -, ( or [
+func startsInfix(e ast.Expression, precedence int) bool {
+	e = unparen(e)
+	if precedence > binding(e) {
+		return true // in parentheses
+	}
+
+	switch e := e.(type) {
+	case *ast.PrefixExpression:
+		return e.Operator == "-"
+	case *ast.InfixExpression:
+		return startsInfix(e.Left, binding(e))
+	case *ast.CallExpression:
+		return startsInfix(e.Function, parser.CALL)
+	case *ast.IndexExpression:
+		return startsInfix(e.Left, parser.INDEX)
+	case *ast.ArrayLiteral:
+		return true
+	default:
+		return false
+	}
+}
+
+// binding is the precedence an expression binds at, which decides whether it
+// needs parentheses within another expression
+func binding(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(e.Token.Type)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	default:
+		// literals, identifiers, calls and indexes, as well as if and fn
+		// which end with a block
+		return parser.INDEX
+	}
+}
+
+// unparen strips any parentheses from around e, the printer adds back those
+// which are needed
+func unparen(e ast.Expression) ast.Expression {
+	for {
+		g, ok := e.(*ast.GroupedExpression)
+		if !ok {
+			return e
+		}
+		e = g.Expression
+	}
+}
+
+// quote gives s as a string literal, escaped in the way the lexer reads it
+func quote(s string) string {
+	var out strings.Builder
+
+	out.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			out.WriteString(`\"`)
+		case r == '\\':
+			out.WriteString(`\\`)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case !unicode.IsPrint(r):
+			fmt.Fprintf(&out, `\u{%x}`, r)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	out.WriteByte('"')
+
+	return out.String()
+}
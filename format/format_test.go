@@ -0,0 +1,215 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sscaling/monkey/lexer"
+	"github.com/sscaling/monkey/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let x=5", "let x = 5;\n"},
+		{"return  x", "return x;\n"},
+		{"return -x;", "return -x;\n"},
+		{"1+2*3", "1 + 2 * 3;\n"},
+		{"(1+2)*3", "(1 + 2) * 3;\n"},
+		{"((1+2))", "1 + 2;\n"},
+		{"1-(2-3)", "1 - (2 - 3);\n"},
+		{"(1-2)-3", "1 - 2 - 3;\n"},
+		{"(a<b)==(c>d)", "a < b == c > d;\n"},
+		{"a||(b&&c)", "a || b && c;\n"},
+		{"(a||b)&&c<=d", "(a || b) && c <= d;\n"},
+		{"1.50+2e3", "1.50 + 2e3;\n"},
+		{"-(1+2)", "-(1 + 2);\n"},
+		{"-(-x)", "-(-x);\n"},
+		{"-(-1)", "-(-1);\n"},
+		{"!(!x)", "!!x;\n"},
+		{"-(!x)", "-!x;\n"},
+		{"!(true)", "!true;\n"},
+		{"(add)(1,2*3)", "add(1, 2 * 3);\n"},
+		{"(fn(x){x})(1)", "fn(x) {\n\tx;\n}(1);\n"},
+		{"[1,(2+3),[]]", "[1, 2 + 3, []];\n"},
+		{"(a[0])[1]+(f(x))[(i)]", "a[0][1] + f(x)[i];\n"},
+		{"(-a)[0]", "(-a)[0];\n"},
+		{"-(a[0])", "-a[0];\n"},
+		{`{"a":1,(b):[],}["a"]`, `{"a": 1, b: []}["a"];` + "\n"},
+		{"{}", "{};\n"},
+		{`"a\"b\\c\nd	e"`, `"a\"b\\c\nd\te";` + "\n"},
+		{`"\u{7}"`, `"\u{7}";` + "\n"},
+		{"fn(){}", "fn() {};\n"},
+		{"let f = fn(x, y) { return x + y; }", "let f = fn(x, y) {\n\treturn x + y;\n};\n"},
+		{"if(x<y){x}else{y}", "if (x < y) {\n\tx;\n} else {\n\ty;\n}\n"},
+		{"if (x) { if (y) { 1 } }", "if (x) {\n\tif (y) {\n\t\t1;\n\t}\n}\n"},
+		{"if (x) { 1 }; -1;", "if (x) {\n\t1;\n};\n-1;\n"},
+		{"if (x) { 1 }; [1];", "if (x) {\n\t1;\n};\n[1];\n"},
+		{"if (x) { 1 }; (a + b) * c;", "if (x) {\n\t1;\n};\n(a + b) * c;\n"},
+		{"if (x) { 1 }; (a)(b);", "if (x) {\n\t1;\n}\na(b);\n"},
+		{"if (x) { 1 }; (-a)[0];", "if (x) {\n\t1;\n};\n(-a)[0];\n"},
+		{"if (x) { 1 }; !a; let b = 1;", "if (x) {\n\t1;\n}\n!a;\nlet b = 1;\n"},
+		{"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;", "let a = 1;\n\nlet b = 2;\nlet c = 3;\n"},
+		{"fn() {\n\tlet a = 1;\n\n\treturn a;\n}", "fn() {\n\tlet a = 1;\n\n\treturn a;\n};\n"},
+		{"let a = 1; let b = 2;", "let a = 1;\nlet b = 2;\n"},
+	}
+
+	for _, tt := range tests {
+		out, err := Source(tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.input, err)
+			continue
+		}
+
+		if out != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, out)
+			continue
+		}
+
+		again, err := Source(out)
+		if err != nil {
+			t.Errorf("%q: formatted output doesn't parse: %v", tt.input, err)
+			continue
+		}
+
+		if again != out {
+			t.Errorf("%q: formatting isn't idempotent, %q became %q", tt.input, out, again)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []string{
+		"if (x) { 1 }; -1;",
+		"if (x) { 1 }; [1];",
+		"if (x) { 1 }; (1 + 2) * 3; if (y) { 2 } else { 3 }; [a][0]",
+		"if (x) { 1 }; (fn(){ 1 })(); if (y) { 2 }; -a - b; if (z) { 3 }",
+		"fn() { if (x) { 1 }; -1 }; if (x) { if (y) { 1 }; [2] }",
+		"if (x) { 1 }; a; if (y) { 2 }; let b = -1; if (z) { 3 }; return [1];",
+		"[1, // one\n 2]; f(a /* x */, b); fn(a /* x */, b) { a }",
+		"-(-1); -(-(-x)); !(-x); -(!x)",
+		"let a = (1 + 2 // sum\n) * 3; {1 // one\n: [2 // two\n], /* b */ 3: 4}",
+		"if (x // x\n) { 1 }; [a // a\n][0 // zero\n]",
+	}
+
+	for _, input := range tests {
+		expected := parse(t, input)
+
+		out, err := Source(input)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", input, err)
+			continue
+		}
+
+		if got := parse(t, out); got != expected {
+			t.Errorf("%q: formatted as %q, which parses as %q instead of %q", input, out, got, expected)
+		}
+	}
+}
+
+// parse gives the AST of input, as a string
+func parse(t *testing.T, input string) string {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("%q: parse errors %v", input, p.Errors())
+	}
+
+	return program.String()
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source("let = 5;")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected *Error, got %T", err)
+	}
+
+	if len(e.Errors) != 1 || e.Errors[0].Code != parser.ErrUnexpectedToken {
+		t.Errorf("expected a single %s error, got %v", parser.ErrUnexpectedToken, e.Errors)
+	}
+}
+
+func TestNode(t *testing.T) {
+	program := parser.New(lexer.New("let a = 1;\n\nlet b = (a + 2) * 3;")).ParseProgram()
+
+	var out bytes.Buffer
+	if err := Node(&out, program); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "let a = 1;\nlet b = (a + 2) * 3;\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+
+	out.Reset()
+	if err := Node(&out, program.Statements[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "let b = (a + 2) * 3;" {
+		t.Errorf("expected the statement alone, got %q", out.String())
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// only a comment", "// only a comment\n"},
+		{"let x = 1;   // one", "let x = 1; // one\n"},
+		{"// about x\n\n\nlet x = 1;", "// about x\n\nlet x = 1;\n"},
+		{"/* two */ let y = x+2;", "/* two */ let y = x + 2;\n"},
+		{"/* two */\nlet y = 2;", "/* two */\nlet y = 2;\n"},
+		{"1 + /* b */ 2", "1 + /* b */ 2;\n"},
+		{"f(1 /* after */)", "f(1 /* after */);\n"},
+		{"f(a /* x */, b)", "f(a /* x */, b);\n"},
+		{"f(a, /* x */ b)", "f(a, /* x */ b);\n"},
+		{"fn(a /* x */, b) { a }", "fn(a /* x */, b) {\n\ta;\n};\n"},
+		{"add(1, // first\n2)", "add(1, // first\n\t2);\n"},
+		{"[1, // one\n 2]", "[1, // one\n\t2];\n"},
+		{"[1, 2 // two\n]", "[1, 2 // two\n];\n"},
+		{"[1 // one\n, 2]", "[1 // one\n\t, 2];\n"},
+		{`{"a" /* key */: 1, /* next */ "b": 2}`, `{"a" /* key */: 1, /* next */ "b": 2};` + "\n"},
+		{"1 /* a */ + 2 * /* b */ 3", "1 /* a */ + 2 * /* b */ 3;\n"},
+		{"(1 + 2 // sum\n) * 3", "(1 + 2) // sum\n\t* 3;\n"},
+		{"a /* a */[/* i */ 0 /* j */]", "a /* a */[/* i */ 0 /* j */];\n"},
+		{"if (x /* x */) { 1 }", "if (x /* x */) {\n\t1;\n}\n"},
+		{"fn() {\n\tlet a = [1, // one\n2];\n}", "fn() {\n\tlet a = [1, // one\n\t\t2];\n};\n"},
+		{"[1 // a\n /* b */]; /* c */", "[1 // a\n\t/* b */]; /* c */\n"},
+		{"f(x); // a\n/* b */", "f(x); // a\n/* b */\n"},
+		{"f(// none\n)", "f(// none\n);\n"},
+		{"if (x) { } // empty", "if (x) {} // empty\n"},
+		{"fn(a) { // adds\n// the sum\nreturn a;\n\n// unreachable\n}", "fn(a) { // adds\n\t// the sum\n\treturn a;\n\n\t// unreachable\n};\n"},
+		{"fn() {\n// nothing\n}", "fn() {\n\t// nothing\n};\n"},
+		{"let a = 1;\n/* multi\n   line */\nlet b = 2;", "let a = 1;\n/* multi\n   line */\nlet b = 2;\n"},
+	}
+
+	for _, tt := range tests {
+		out, err := Source(tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.input, err)
+			continue
+		}
+
+		if out != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, out)
+			continue
+		}
+
+		if again, _ := Source(out); again != out {
+			t.Errorf("%q: formatting isn't idempotent, %q became %q", tt.input, out, again)
+		}
+	}
+}
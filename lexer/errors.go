@@ -0,0 +1,28 @@
+package lexer
+
+import "fmt"
+
+// Codes for the problems the lexer can report. These are stable, so tools can
+// rely on them.
+const (
+	ErrIllegalCharacter    = "L001"
+	ErrUnterminatedString  = "L002"
+	ErrInvalidEscape       = "L003"
+	ErrUnterminatedComment = "L004"
+	ErrInvalidUTF8         = "L005"
+	ErrRead                = "L006" // the reader given to NewReader failed
+	ErrMalformedNumber     = "L007"
+)
+
+// Error is a problem found in the input, at the given position
+type Error struct {
+	Code    string
+	Message string
+	Line    int
+	Column  int
+	Offset  int // in bytes from the start of the input
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
@@ -2,54 +2,201 @@ package lexer
 
 import (
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/sscaling/monkey/token"
 )
 
 type Lexer struct {
-	input        string
+	input        []byte
 	position     int // need to track both position and currPosition for slicing the input data
 	line         int
 	column       int
 	readPosition int
-	ch           byte
+	ch           rune
+
+	base int // added to positions, see token.FileSet
+
+	// when lexing from a reader, input is a window onto what's been read so
+	// far, starting at offset. Chunks are appended to it as characters are
+	// needed and the text before each token is discarded, so a long token
+	// costs no more to read than a short one.
+	reader  io.Reader
+	offset  int
+	chunk   []byte
+	readErr error // reported on reaching the end of what was read
+
+	comments bool // return comments as tokens, rather than skipping them
+	tabWidth int  // see token.NextColumn
+
+	errors []Error
+}
+
+// Option configures a Lexer
+type Option func(*Lexer)
+
+// WithTabWidth sets the number of columns a tab takes up, for the columns of
+// tokens and errors. By default it's 1, like any other character.
+func WithTabWidth(n int) Option {
+	return func(l *Lexer) {
+		if n > 0 {
+			l.tabWidth = n
+		}
+	}
+}
+
+// WithComments has NextToken return comments as COMMENT tokens. By default
+// they're skipped like whitespace.
+func WithComments() Option {
+	return func(l *Lexer) {
+		l.comments = true
+	}
+}
+
+func New(program string, opts ...Option) *Lexer {
+	l := &Lexer{input: []byte(program), line: 1, tabWidth: 1}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.readChar()
+	return l
 }
 
-func New(program string) *Lexer {
-	l := &Lexer{input: program, line: 1, column: 1}
+// NewReader lexes the input read from r, a chunk at a time, giving the same
+// tokens as New would for the whole input
+func NewReader(r io.Reader, opts ...Option) *Lexer {
+	l := &Lexer{reader: r, line: 1, tabWidth: 1, chunk: make([]byte, chunkSize)}
+	for _, opt := range opts {
+		opt(l)
+	}
 	l.readChar()
 	return l
 }
 
+// chunkSize is how much NewReader's lexer reads at once
+const chunkSize = 4096
+
+// NewFile lexes the source of f, giving tokens positions within its FileSet.
+// Columns use the tab width of f, unless an option sets another.
+func NewFile(f *token.File, opts ...Option) *Lexer {
+	l := New(f.Source(), append([]Option{WithTabWidth(f.TabWidth())}, opts...)...)
+	l.base = f.Base()
+	return l
+}
+
+// Base is the offset added to the positions of tokens
+func (l *Lexer) Base() int {
+	return l.base
+}
+
+// Errors returns the problems found in the input so far. Tokens which could not
+// be lexed are also returned as ILLEGAL.
+func (l *Lexer) Errors() []Error {
+	return l.errors
+}
+
+// error records a problem, offset being an index into l.input
+func (l *Lexer) error(code string, line, column, offset int, format string, a ...interface{}) {
+	l.errors = append(l.errors, Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+		Line:    line,
+		Column:  column,
+		Offset:  l.offset + offset,
+	})
+}
+
+// pos gives the position of an index into l.input
+func (l *Lexer) pos(i int) int {
+	return l.base + l.offset + i
+}
+
+// fill reads from the reader, if there is one, until there's at least a whole
+// character after l.readPosition or the input has all been read
+func (l *Lexer) fill() {
+	for l.reader != nil && len(l.input)-l.readPosition < utf8.UTFMax {
+		n, err := l.reader.Read(l.chunk)
+		l.input = append(l.input, l.chunk[:n]...)
+
+		if err != nil {
+			if err != io.EOF {
+				l.readErr = err
+			}
+			l.reader = nil
+		}
+	}
+}
+
+// discard drops the input before l.position, which has been lexed. Only
+// needed when reading, to keep the window small: the dropped bytes are freed
+// once fill outgrows the buffer, which copies just what's kept.
+func (l *Lexer) discard() {
+	if l.reader == nil {
+		return
+	}
+
+	l.input = l.input[l.position:]
+	l.offset += l.position
+	l.readPosition -= l.position
+	l.position = 0
+}
+
 func (l *Lexer) readChar() {
-	// if previous character was a new line, reset position counters
-	if l.ch == '\n' {
+	switch {
+	case l.offset+l.readPosition == 0:
+		l.column = 1
+	case l.ch == '\n':
+		// if previous character was a new line, reset position counters
 		l.line += 1
-		l.column = 0
+		l.column = 1
+	case l.position < len(l.input):
+		// the end of input is the column after the last character, so
+		// this includes moving on to it
+		l.column = token.NextColumn(l.column, l.ch, l.tabWidth)
 	}
 
+	l.fill()
+
+	width := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
-
-		// for any character, other than carriage return, assume we increment one column
-		// in the input. NOTE: this may not be suitable for tabs?
-		if l.ch != '\r' {
-			l.column += 1
-		}
+		l.ch, width = utf8.DecodeRune(l.input[l.readPosition:])
 	}
+
 	// Always set the position and increase the readPosition as this is used for slicing the input data
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
+
+	if l.invalidChar() {
+		l.error(ErrInvalidUTF8, l.line, l.column, l.position, "invalid UTF-8 encoding")
+	}
+
+	if l.position >= len(l.input) && l.readErr != nil {
+		l.error(ErrRead, l.line, l.column, l.position, "reading input: %s", l.readErr)
+		l.readErr = nil
+	}
+}
+
+// invalidChar is whether l.ch is a byte which isn't valid UTF-8, rather than
+// an encoded U+FFFD
+func (l *Lexer) invalidChar() bool {
+	return l.ch == utf8.RuneError && l.readPosition-l.position == 1
 }
 
-func (l *Lexer) peakChar() byte {
+func (l *Lexer) peakChar() rune {
+	l.fill()
+
 	if (l.readPosition) >= len(l.input) {
 		return 0
 	}
 
-	return l.input[l.readPosition]
+	r, _ := utf8.DecodeRune(l.input[l.readPosition:])
+	return r
 }
 
 func (l *Lexer) eatWhitespace() {
@@ -59,10 +206,21 @@ func (l *Lexer) eatWhitespace() {
 }
 
 func (l *Lexer) NextToken() token.Token {
+	for {
+		t := l.next()
+		if t.Type != token.COMMENT || l.comments {
+			return t
+		}
+	}
+}
+
+func (l *Lexer) next() token.Token {
 
 	l.eatWhitespace()
+	l.discard()
 
 	var t token.Token
+	t.Position = l.pos(l.position)
 	t.Line = l.line
 	t.Column = l.column
 
@@ -93,6 +251,12 @@ func (l *Lexer) NextToken() token.Token {
 		t = newToken(token.LBRACE, l)
 	case '}' == l.ch:
 		t = newToken(token.RBRACE, l)
+	case ':' == l.ch:
+		t = newToken(token.COLON, l)
+	case '[' == l.ch:
+		t = newToken(token.LBRACKET, l)
+	case ']' == l.ch:
+		t = newToken(token.RBRACKET, l)
 	case '+' == l.ch:
 		t = newToken(token.PLUS, l)
 	case '-' == l.ch:
@@ -100,85 +264,381 @@ func (l *Lexer) NextToken() token.Token {
 	case '*' == l.ch:
 		t = newToken(token.MULTIPLY, l)
 	case '/' == l.ch:
-		t = newToken(token.DIVIDE, l)
+		switch l.peakChar() {
+		case '/':
+			t.Type = token.COMMENT
+			t.Literal = l.readLineComment()
+			t.End = t.Position + len(t.Literal)
+			return t
+		case '*':
+			if value, ok := l.readBlockComment(); ok {
+				t.Type = token.COMMENT
+				t.Literal = value
+			} else {
+				t.Type = token.ILLEGAL
+				t.Literal = value
+				t.End = l.pos(l.position)
+				return t
+			}
+		default:
+			t = newToken(token.DIVIDE, l)
+		}
 	case '<' == l.ch:
-		t = newToken(token.LESS_THAN, l)
+		if l.peakChar() == '=' {
+			l.readChar()
+			t.Type = token.LT_EQ
+			t.Literal = "<="
+		} else {
+			t = newToken(token.LESS_THAN, l)
+		}
 	case '>' == l.ch:
-		t = newToken(token.GREATER_THAN, l)
+		if l.peakChar() == '=' {
+			l.readChar()
+			t.Type = token.GT_EQ
+			t.Literal = ">="
+		} else {
+			t = newToken(token.GREATER_THAN, l)
+		}
+	case '&' == l.ch && l.peakChar() == '&':
+		l.readChar()
+		t.Type = token.AND
+		t.Literal = "&&"
+	case '|' == l.ch && l.peakChar() == '|':
+		l.readChar()
+		t.Type = token.OR
+		t.Literal = "||"
 	case ',' == l.ch:
 		t = newToken(token.COMMA, l)
 	case ';' == l.ch:
 		t = newToken(token.SEMI_COLON, l)
+	case '"' == l.ch:
+		if value, ok := l.readString(); ok {
+			t.Type = token.STRING
+			t.Literal = value
+		} else {
+			t.Type = token.ILLEGAL
+			t.Literal = value
+		}
 	case 0 == l.ch:
 		t.Literal = ""
 		t.Type = token.EOF
+		t.End = t.Position
+		return t
 	default:
 		if isInteger(l.ch) {
-			t.Literal = l.readInteger()
-			t.Type = token.INTEGER
+			t.Literal, t.Type = l.readNumber()
+			t.End = l.pos(l.position)
 			return t
 		} else if isLetter(l.ch) {
 			// return immediately as readIdentifier has already moved onto the next position
 			t.Literal = l.readIdentifier()
 			t.Type = token.LookupIdentifier(t.Literal)
+			t.End = l.pos(l.position)
 			return t
 		} else {
 			t = newToken(token.ILLEGAL, l)
+			// readChar has already reported invalid UTF-8
+			if !l.invalidChar() {
+				l.error(ErrIllegalCharacter, t.Line, t.Column, l.position, "illegal character %q", l.ch)
+			}
 		}
 	}
 
 	l.readChar()
+	t.End = l.pos(l.position)
 
 	return t
 }
 
+// readLineComment reads a // comment, up to but not including the end of the
+// line
+func (l *Lexer) readLineComment() string {
+	start := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+
+	return strings.TrimSuffix(string(l.input[start:l.position]), "\r")
+}
+
+// readBlockComment reads a /* */ comment, leaving l.ch on the closing /. When
+// the comment is not terminated it reads to the end of the input, and returns
+// false.
+func (l *Lexer) readBlockComment() (string, bool) {
+	start := l.position
+	line, column := l.line, l.column
+
+	l.readChar()
+	for {
+		l.readChar()
+
+		switch {
+		case l.ch == '*' && l.peakChar() == '/':
+			l.readChar()
+			return string(l.input[start:l.readPosition]), true
+		case l.ch == 0:
+			l.error(ErrUnterminatedComment, line, column, start, "unterminated block comment")
+			return string(l.input[start:l.position]), false
+		}
+	}
+}
+
+// readString reads a double quoted string, starting on the opening quote and
+// leaving l.ch on the closing one. The returned value has escape sequences
+// replaced. When the string is not terminated, the raw text is returned along
+// with false.
+func (l *Lexer) readString() (string, bool) {
+	start := l.position
+	line, column := l.line, l.column
+
+	var out strings.Builder
+	for {
+		l.readChar()
+
+		if l.ch == '\\' {
+			l.readEscape(&out)
+			continue
+		}
+
+		switch l.ch {
+		case '"':
+			return out.String(), true
+		case 0:
+			l.error(ErrUnterminatedString, line, column, start, "unterminated string")
+			return string(l.input[start:l.position]), false
+		default:
+			// as written, so invalid UTF-8 is kept rather than replaced
+			out.Write(l.input[l.position:l.readPosition])
+		}
+	}
+}
+
+// readEscape handles the character(s) after a backslash within a string
+func (l *Lexer) readEscape(out *strings.Builder) {
+	line, column, offset := l.line, l.column, l.position
+
+	l.readChar()
+
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case '"':
+		out.WriteByte('"')
+	case '\\':
+		out.WriteByte('\\')
+	case 'u':
+		// \u{<hex>}
+		if l.peakChar() != '{' {
+			l.error(ErrInvalidEscape, line, column, offset, "invalid unicode escape, expected \\u{...}")
+			return
+		}
+		l.readChar()
+
+		start := l.readPosition
+		for isHexDigit(l.peakChar()) {
+			l.readChar()
+		}
+		digits := string(l.input[start:l.readPosition])
+
+		if l.peakChar() != '}' {
+			l.error(ErrInvalidEscape, line, column, offset, "invalid unicode escape, expected \\u{...}")
+			return
+		}
+		l.readChar()
+
+		code, err := strconv.ParseUint(digits, 16, 32)
+		if err != nil || len(digits) > 6 || !utf8.ValidRune(rune(code)) {
+			l.error(ErrInvalidEscape, line, column, offset, "invalid unicode code point \\u{%s}", digits)
+			return
+		}
+		out.WriteRune(rune(code))
+	case 0:
+		// end of input; step back so readString reads the end again (rather
+		// than past it) and reports the unterminated string
+		l.readPosition--
+	default:
+		l.error(ErrInvalidEscape, line, column, offset, "unknown escape sequence \\%c", l.ch)
+	}
+}
+
+func isHexDigit(ch rune) bool {
+	return isInteger(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
+// readIdentifier reads a letter followed by any letters and digits, as in Go
 func (l *Lexer) readIdentifier() string {
 	start := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || unicode.IsDigit(l.ch) {
 		l.readChar()
 	}
 
-	return l.input[start:l.position]
+	return string(l.input[start:l.position])
 }
 
-func isLetter(ch byte) bool {
-	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '_'
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-func (l *Lexer) readInteger() string {
+// readNumber reads an integer, or a float with a fraction and/or an exponent
+// such as 3.14, 1e-9 or 2.5E3. Integers may have a 0x, 0o or 0b prefix, and
+// any number can have its digits separated with _, i.e. 1_000_000. A leading 0
+// alone means octal, as in Go.
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	start := l.position
-	for isInteger(l.ch) {
+	line, column := l.line, l.column
+	tokenType := token.TokenType(token.INTEGER)
+
+	base := 10
+	if l.ch == '0' {
+		switch unicode.ToLower(l.peakChar()) {
+		case 'x':
+			base = 16
+		case 'o':
+			base = 8
+		case 'b':
+			base = 2
+		}
+
+		if base != 10 {
+			l.readChar()
+			l.readChar()
+		}
+	}
+
+	digits, invalid := l.readDigits(base)
+	problem := ""
+
+	if base == 10 {
+		if l.ch == '.' && isInteger(l.peakChar()) {
+			tokenType = token.FLOAT
+			l.readChar()
+			l.readDigits(10)
+		}
+
+		if l.ch == 'e' || l.ch == 'E' {
+			tokenType = token.FLOAT
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+
+			if n, _ := l.readDigits(10); n == 0 {
+				problem = "exponent has no digits"
+			}
+		}
+	}
+
+	literal := string(l.input[start:l.position])
+
+	if base == 10 && tokenType == token.INTEGER && len(literal) > 1 && literal[0] == '0' {
+		// 0 followed by digits is octal
+		base = 8
+		invalid = 0
+		for _, d := range literal {
+			if d >= '8' && d <= '9' {
+				invalid = d
+				break
+			}
+		}
+	}
+
+	switch {
+	case problem != "":
+	case digits == 0:
+		problem = fmt.Sprintf("%s literal has no digits", baseNames[base])
+	case invalid != 0:
+		problem = fmt.Sprintf("invalid digit %q in %s literal", invalid, baseNames[base])
+	case !separatorsOK(literal):
+		problem = "'_' must separate successive digits"
+	}
+
+	if problem != "" {
+		l.error(ErrMalformedNumber, line, column, start, "malformed number %q, %s", literal, problem)
+		return literal, token.ILLEGAL
+	}
+
+	return literal, tokenType
+}
+
+var baseNames = map[int]string{2: "binary", 8: "octal", 10: "decimal", 16: "hexadecimal"}
+
+// readDigits reads the digits of a number in the given base, along with any _
+// separators. It returns how many digits there were, and the first which is
+// too large for the base (or 0). Digits 8 and 9 are read for any base less
+// than 10, so that 0b12 is reported rather than being lexed as two numbers.
+func (l *Lexer) readDigits(base int) (int, rune) {
+	digits := 0
+	var invalid rune
+
+	for {
+		switch {
+		case l.ch == '_':
+		case isInteger(l.ch) || (base == 16 && isHexDigit(l.ch)):
+			digits++
+			if invalid == 0 && base <= 10 && int(l.ch-'0') >= base {
+				invalid = l.ch
+			}
+		default:
+			return digits, invalid
+		}
+
 		l.readChar()
 	}
+}
+
+// separatorsOK reports whether each _ in a number is between two digits, or
+// between a base prefix and a digit
+func separatorsOK(literal string) bool {
+	digit := isInteger
+	if len(literal) > 1 && unicode.ToLower(rune(literal[1])) == 'x' {
+		digit = isHexDigit
+	}
+
+	for i, ch := range literal {
+		if ch != '_' {
+			continue
+		}
+
+		afterPrefix := i == 2 && literal[0] == '0' && unicode.IsLetter(rune(literal[1]))
+		if !afterPrefix && (i == 0 || !digit(rune(literal[i-1]))) {
+			return false
+		}
+
+		if i+1 >= len(literal) || !digit(rune(literal[i+1])) {
+			return false
+		}
+	}
 
-	return l.input[start:l.position]
+	return true
 }
 
-func isInteger(ch byte) bool {
+func isInteger(ch rune) bool {
 	return ch >= '0' && ch <= '9'
 }
 
-func isWhitespace(ch byte) bool {
+func isWhitespace(ch rune) bool {
 	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
 }
 
 func newToken(t token.TokenType, l *Lexer) token.Token {
-	return token.Token{Type: t, Literal: string(l.ch), Line: l.line, Column: l.column}
+	return token.Token{Type: t, Literal: string(l.input[l.position:l.readPosition]), Position: l.pos(l.position), Line: l.line, Column: l.column}
 }
 
 func (l *Lexer) Debug() {
-	charOrWhitespace := func(b rune) byte {
-		if isWhitespace(byte(b)) {
-			return byte(' ')
+	charOrWhitespace := func(r rune) rune {
+		if isWhitespace(r) {
+			return ' '
 		} else {
-			return byte(b)
+			return r
 		}
 	}
 
 	line := 1
 	column := 0
 	fmt.Printf("\n%05d: ", line)
-	for _, x := range l.input {
+	for _, x := range string(l.input) {
 		if x == '\n' {
 			line += 1
 			column = 0
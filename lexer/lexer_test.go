@@ -13,6 +13,101 @@ func TestIllegalChar(t *testing.T) {
 	}
 }
 
+func TestNumbers(t *testing.T) {
+	input := "3 3.14 1e-9 2.5E3 1E+2 0.5 7. 8.x 0xFF 0Xdead_BEEF 0o17 0b1010 0b_1 1_000_000 1_0.2_5e1_0 017 0"
+
+	expected := []struct {
+		tokenType token.TokenType
+		literal   string
+	}{
+		{token.INTEGER, "3"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2.5E3"},
+		{token.FLOAT, "1E+2"},
+		{token.FLOAT, "0.5"},
+		{token.INTEGER, "7"},
+		{token.ILLEGAL, "."},
+		{token.INTEGER, "8"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.INTEGER, "0xFF"},
+		{token.INTEGER, "0Xdead_BEEF"},
+		{token.INTEGER, "0o17"},
+		{token.INTEGER, "0b1010"},
+		{token.INTEGER, "0b_1"},
+		{token.INTEGER, "1_000_000"},
+		{token.FLOAT, "1_0.2_5e1_0"},
+		{token.INTEGER, "017"},
+		{token.INTEGER, "0"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for _, e := range expected {
+		tok := l.NextToken()
+		if tok.Type != e.tokenType || tok.Literal != e.literal {
+			t.Errorf("expected %s %q, got %s", e.tokenType, e.literal, tok.Pretty())
+		}
+	}
+}
+
+func TestMalformedNumbers(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"1e", `1:1: malformed number "1e", exponent has no digits`},
+		{"x = 2.5e+;", `1:5: malformed number "2.5e+", exponent has no digits`},
+		{"0x", `1:1: malformed number "0x", hexadecimal literal has no digits`},
+		{"0B;", `1:1: malformed number "0B", binary literal has no digits`},
+		{"0b102", `1:1: malformed number "0b102", invalid digit '2' in binary literal`},
+		{"0o78", `1:1: malformed number "0o78", invalid digit '8' in octal literal`},
+		{"089", `1:1: malformed number "089", invalid digit '8' in octal literal`},
+		{"1__0", `1:1: malformed number "1__0", '_' must separate successive digits`},
+		{"1_", `1:1: malformed number "1_", '_' must separate successive digits`},
+		{"0x_", `1:1: malformed number "0x_", hexadecimal literal has no digits`},
+		{"1_.5", `1:1: malformed number "1_.5", '_' must separate successive digits`},
+		{"0_x", `1:1: malformed number "0_", '_' must separate successive digits`},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		tok := l.NextToken()
+		for tok.Type != token.ILLEGAL && tok.Type != token.EOF {
+			tok = l.NextToken()
+		}
+
+		if tok.Type != token.ILLEGAL {
+			t.Errorf("%q: expected an ILLEGAL token", tt.input)
+		}
+
+		errors := l.Errors()
+		if len(errors) != 1 || errors[0].Code != ErrMalformedNumber || errors[0].Error() != tt.expectedError {
+			t.Errorf("%q: expected %s %q, got %v", tt.input, ErrMalformedNumber, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestTwoCharOperators(t *testing.T) {
+	input := "a <= b >= c && d || !e < f > g == h != i & |"
+
+	expected := []token.TokenType{
+		token.IDENT, token.LT_EQ, token.IDENT, token.GT_EQ, token.IDENT, token.AND, token.IDENT, token.OR,
+		token.BANG, token.IDENT, token.LESS_THAN, token.IDENT, token.GREATER_THAN, token.IDENT,
+		token.EQUALS, token.IDENT, token.NOT_EQUAL, token.IDENT, token.ILLEGAL, token.ILLEGAL, token.EOF,
+	}
+
+	l := New(input)
+	for i, e := range expected {
+		tok := l.NextToken()
+		if tok.Type != e {
+			t.Fatalf("token %d: expected %s, got %s", i, e, tok.Pretty())
+		}
+	}
+}
+
 func TestBasicLex(t *testing.T) {
 
 	input := `let five = 5;
@@ -23,7 +118,7 @@ func TestBasicLex(t *testing.T) {
 	};
 
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 
 	if (5 < 10) {
@@ -34,6 +129,8 @@ func TestBasicLex(t *testing.T) {
 
 	10 == 10;
 	10 != 9;
+	[1, 2];
+	{"foo": "bar"}
 	`
 	l := New(input)
 
@@ -124,6 +221,19 @@ func TestBasicLex(t *testing.T) {
 		{token.INTEGER, "9"},
 		{token.SEMI_COLON, ";"},
 
+		{token.LBRACKET, "["},
+		{token.INTEGER, "1"},
+		{token.COMMA, ","},
+		{token.INTEGER, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMI_COLON, ";"},
+
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
+
 		{token.EOF, ""},
 	}
 
@@ -141,3 +251,284 @@ func TestBasicLex(t *testing.T) {
 		}
 	}
 }
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{`"foobar"`, "foobar"},
+		{`"foo bar"`, "foo bar"},
+		{`""`, ""},
+		{`"a\nb\tc"`, "a\nb\tc"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"back\\slash"`, `back\slash`},
+		{`"\u{48}\u{e9}\u{1F600}"`, "Hé😀"},
+		{"\"multi\nline\"", "multi\nline"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.STRING {
+			t.Fatalf("%s: expected STRING, got %s", tt.input, tok.Pretty())
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("%s: expected literal %q, got %q", tt.input, tt.expectedLiteral, tok.Literal)
+		}
+
+		if len(l.Errors()) != 0 {
+			t.Errorf("%s: unexpected errors %v", tt.input, l.Errors())
+		}
+
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("%s: expected EOF, got %s", tt.input, tok.Pretty())
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedType   token.TokenType
+		expectedCode   string
+		expectedError  string
+		expectedOffset int
+	}{
+		{`let s = "foo`, token.ILLEGAL, ErrUnterminatedString, "1:9: unterminated string", 8},
+		{"\n  \"foo\\", token.ILLEGAL, ErrUnterminatedString, "2:3: unterminated string", 3},
+		{`"\q"`, token.STRING, ErrInvalidEscape, `1:2: unknown escape sequence \q`, 1},
+		{`"\u41"`, token.STRING, ErrInvalidEscape, `1:2: invalid unicode escape, expected \u{...}`, 1},
+		{`"\u{110000}"`, token.STRING, ErrInvalidEscape, `1:2: invalid unicode code point \u{110000}`, 1},
+		{`"\u{}"`, token.STRING, ErrInvalidEscape, `1:2: invalid unicode code point \u{}`, 1},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		tok := l.NextToken()
+		for tok.Type != token.STRING && tok.Type != token.ILLEGAL && tok.Type != token.EOF {
+			tok = l.NextToken()
+		}
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("%q: expected %s, got %s", tt.input, tt.expectedType, tok.Pretty())
+		}
+
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Errorf("%q: expected 1 error, got %q", tt.input, errors)
+			continue
+		}
+
+		err := errors[0]
+		if err.Error() != tt.expectedError || err.Code != tt.expectedCode || err.Offset != tt.expectedOffset {
+			t.Errorf("%q: expected error %s %q at offset %d, got %s %q at offset %d", tt.input,
+				tt.expectedCode, tt.expectedError, tt.expectedOffset, err.Code, err.Error(), err.Offset)
+		}
+
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("%q: expected EOF, got %s", tt.input, tok.Pretty())
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 10;\n  x == \"a\\n\";"
+
+	expected := []struct {
+		literal  string
+		position int
+		end      int
+		line     int
+		column   int
+	}{
+		{"let", 0, 3, 1, 1},
+		{"x", 4, 5, 1, 5},
+		{"=", 6, 7, 1, 7},
+		{"10", 8, 10, 1, 9},
+		{";", 10, 11, 1, 11},
+		{"x", 14, 15, 2, 3},
+		{"==", 16, 18, 2, 5},
+		{"a\n", 19, 24, 2, 8},
+		{";", 24, 25, 2, 13},
+		{"", 25, 25, 2, 14},
+		{"", 25, 25, 2, 14},
+	}
+
+	l := New(input)
+	for _, e := range expected {
+		tok := l.NextToken()
+		if tok.Literal != e.literal || tok.Position != e.position || tok.End != e.end || tok.Line != e.line || tok.Column != e.column {
+			t.Errorf("expected %q at offset %d-%d [%d:%d], got %q at offset %d-%d [%d:%d]", e.literal, e.position, e.end, e.line, e.column,
+				tok.Literal, tok.Position, tok.End, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestNewFile(t *testing.T) {
+	fset := token.NewFileSet()
+	fset.AddFile("first.mk", "let a = 1;")
+	f := fset.AddFile("second.mk", "let b = 2;\nb")
+
+	l := NewFile(f)
+
+	var last token.Token
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		last = tok
+	}
+
+	if pos := fset.Position(token.Pos(last.Position)).String(); pos != "second.mk:2:1" {
+		t.Errorf("expected last token at second.mk:2:1, got %s", pos)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// leading\nlet x = 1; // trailing\r\n/* block\n spanning */ x / /**/ 2 // end"
+
+	expected := []struct {
+		tokenType token.TokenType
+		literal   string
+		line      int
+		column    int
+		end       int
+	}{
+		{token.COMMENT, "// leading", 1, 1, 10},
+		{token.LET, "let", 2, 1, 14},
+		{token.IDENT, "x", 2, 5, 16},
+		{token.ASSIGN, "=", 2, 7, 18},
+		{token.INTEGER, "1", 2, 9, 20},
+		{token.SEMI_COLON, ";", 2, 10, 21},
+		{token.COMMENT, "// trailing", 2, 12, 33},
+		{token.COMMENT, "/* block\n spanning */", 3, 1, 56},
+		{token.IDENT, "x", 4, 14, 58},
+		{token.DIVIDE, "/", 4, 16, 60},
+		{token.COMMENT, "/**/", 4, 18, 65},
+		{token.INTEGER, "2", 4, 23, 67},
+		{token.COMMENT, "// end", 4, 25, 74},
+		{token.EOF, "", 4, 31, 74},
+	}
+
+	l := New(input, WithComments())
+	for _, e := range expected {
+		tok := l.NextToken()
+		if tok.Type != e.tokenType || tok.Literal != e.literal || tok.Line != e.line || tok.Column != e.column || tok.End != e.end {
+			t.Errorf("expected %s %q [%d:%d] ending at %d, got %s ending at %d", e.tokenType, e.literal, e.line, e.column, e.end,
+				tok.Pretty(), tok.End)
+		}
+	}
+
+	// without the option comments are skipped
+	l = New(input)
+	types := []token.TokenType{}
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		types = append(types, tok.Type)
+	}
+
+	for _, tt := range types {
+		if tt == token.COMMENT {
+			t.Fatalf("expected comments to be skipped, got %v", types)
+		}
+	}
+
+	if len(types) != 8 {
+		t.Errorf("expected 8 tokens, got %v", types)
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	l := New("x;\n  /* never closed\n", WithComments())
+
+	l.NextToken()
+	l.NextToken()
+
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL || tok.Literal != "/* never closed\n" {
+		t.Errorf("expected ILLEGAL for the comment, got %s", tok.Pretty())
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, got %q", errors)
+	}
+
+	if err := errors[0]; err.Code != ErrUnterminatedComment || err.Error() != "2:3: unterminated block comment" || err.Offset != 5 {
+		t.Errorf("expected %s at offset 5, got %s %q at offset %d", ErrUnterminatedComment, err.Code, err.Error(), err.Offset)
+	}
+
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Errorf("expected EOF, got %s", tok.Pretty())
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "let π2 = \"héllo, 世界\";\n\tnaïve_ß + x١"
+
+	expected := []struct {
+		tokenType token.TokenType
+		literal   string
+		line      int
+		column    int
+	}{
+		{token.LET, "let", 1, 1},
+		{token.IDENT, "π2", 1, 5},
+		{token.ASSIGN, "=", 1, 8},
+		{token.STRING, "héllo, 世界", 1, 10},
+		{token.SEMI_COLON, ";", 1, 21},
+		{token.IDENT, "naïve_ß", 2, 5},
+		{token.PLUS, "+", 2, 13},
+		{token.IDENT, "x١", 2, 15},
+		{token.EOF, "", 2, 17},
+	}
+
+	l := New(input, WithTabWidth(4))
+	for _, e := range expected {
+		tok := l.NextToken()
+		if tok.Type != e.tokenType || tok.Literal != e.literal || tok.Line != e.line || tok.Column != e.column {
+			t.Errorf("expected %s %q [%d:%d], got %s", e.tokenType, e.literal, e.line, e.column, tok.Pretty())
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("unexpected errors %v", l.Errors())
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	tests := []struct {
+		input         string
+		expected      []token.TokenType
+		expectedError string
+	}{
+		{"x \xff y", []token.TokenType{token.IDENT, token.ILLEGAL, token.IDENT}, "1:3: invalid UTF-8 encoding"},
+		{"\"a\xc3\"", []token.TokenType{token.STRING}, "1:3: invalid UTF-8 encoding"},
+		{"é €\n\xe2\x82", []token.TokenType{token.IDENT, token.ILLEGAL, token.ILLEGAL, token.ILLEGAL}, "1:3: illegal character '€'"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		types := []token.TokenType{}
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			types = append(types, tok.Type)
+		}
+
+		if len(types) != len(tt.expected) {
+			t.Errorf("%q: expected tokens %v, got %v", tt.input, tt.expected, types)
+		} else {
+			for i := range types {
+				if types[i] != tt.expected[i] {
+					t.Errorf("%q: expected tokens %v, got %v", tt.input, tt.expected, types)
+					break
+				}
+			}
+		}
+
+		errors := l.Errors()
+		if len(errors) == 0 || errors[0].Error() != tt.expectedError {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package lexer
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/sscaling/monkey/token"
+)
+
+func TestReaderMatchesString(t *testing.T) {
+	// runs of multi-byte characters, so that some straddle the chunks
+	long := strings.Repeat("let naïve = \"世界 \\u{1F600}\"; // π\n\tx /* ü */ + 10;\r\n", 400)
+
+	inputs := []string{
+		"",
+		"let five = 5;\nlet add = fn(x, y) { x + y; };\n!-/ *5;\n10 != 9;",
+		`"foo" "a\nb" "say \"hi\"" "\u{48}\u{e9}" "\q" "unterminated`,
+		"// leading\nlet x = 1; /* block\n spanning */ x / 2 // end",
+		"x; /* never closed",
+		"let π2 = \"héllo\";\n\tnaïve_ß + x١ €",
+		"x \xff y \"a\xc3\" \xe2\x82",
+		long,
+		"x \"" + strings.Repeat("ab", 5*chunkSize) + "\" /* " + strings.Repeat("c", 3*chunkSize) + " */ y",
+	}
+
+	readers := map[string]func(string) io.Reader{
+		"reader":   func(s string) io.Reader { return strings.NewReader(s) },
+		"one byte": func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) },
+		"half":     func(s string) io.Reader { return iotest.HalfReader(strings.NewReader(s)) },
+		"data err": func(s string) io.Reader { return iotest.DataErrReader(strings.NewReader(s)) },
+	}
+
+	for _, input := range inputs {
+		expected, expectedErrors := lexAll(New(input, WithComments(), WithTabWidth(4)))
+
+		for name, reader := range readers {
+			actual, errors := lexAll(NewReader(reader(input), WithComments(), WithTabWidth(4)))
+
+			if len(actual) != len(expected) {
+				t.Errorf("%s %.20q: expected %d tokens, got %d", name, input, len(expected), len(actual))
+				continue
+			}
+
+			for i := range expected {
+				if actual[i] != expected[i] {
+					t.Errorf("%s %.20q: token %d: expected %s (%d-%d), got %s (%d-%d)", name, input, i,
+						expected[i].Pretty(), expected[i].Position, expected[i].End,
+						actual[i].Pretty(), actual[i].Position, actual[i].End)
+					break
+				}
+			}
+
+			if !reflect.DeepEqual(errors, expectedErrors) {
+				t.Errorf("%s %.20q: expected errors %v, got %v", name, input, expectedErrors, errors)
+			}
+		}
+	}
+}
+
+func TestReaderWindow(t *testing.T) {
+	l := NewReader(strings.NewReader(strings.Repeat("let x = 10;\n", 100*chunkSize)))
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if cap(l.input) > 4*chunkSize {
+			t.Fatalf("expected what's been lexed to be dropped, got a buffer of %d bytes at %d", cap(l.input), tok.Position)
+		}
+	}
+}
+
+func TestReaderError(t *testing.T) {
+	l := NewReader(iotest.TimeoutReader(strings.NewReader("let x")))
+
+	tokens, errors := lexAll(l)
+	if len(tokens) != 3 || tokens[1].Literal != "x" {
+		t.Errorf("expected the tokens read before the error, got %v", tokens)
+	}
+
+	if len(errors) != 1 || errors[0].Code != ErrRead || errors[0].Error() != "1:6: reading input: timeout" || errors[0].Offset != 5 {
+		t.Errorf("expected a read error at offset 5, got %v", errors)
+	}
+}
+
+// lexAll returns every token up to and including EOF
+func lexAll(l *Lexer) ([]token.Token, []Error) {
+	tokens := []token.Token{}
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			return tokens, l.Errors()
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Package monkey runs Monkey programs from Go. An Interpreter keeps the
+// bindings of the programs it evaluates, and values are converted between
+// Go and Monkey as they pass in and out:
+//
+//	interp := monkey.New()
+//	interp.Set("greeting", "Hello")
+//	interp.Set("upper", strings.ToUpper)
+//	interp.Eval(`let greet = fn(name) { upper(greeting + ", " + name) }`)
+//	result, err := interp.Call("greet", "monkey") // "HELLO, MONKEY"
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/sscaling/monkey/evaluator"
+	"github.com/sscaling/monkey/lexer"
+	"github.com/sscaling/monkey/object"
+	"github.com/sscaling/monkey/parser"
+)
+
+// Interpreter evaluates programs in an environment which lasts between
+// them. It isn't safe for concurrent use.
+//
+// Go values are converted to Monkey with object.FromGo: numbers, booleans,
+// strings, slices, maps with integer, boolean or string keys, and functions,
+// which become builtins. Monkey values are converted back to int64, float64,
+// bool, string, []interface{} and map[interface{}]interface{}, with nil for
+// null. A Monkey function, or builtin, is returned as a
+// func(args ...interface{}) (interface{}, error), which runs it with the
+// Limits, and a Go function bound with Set can take one as a func parameter
+// (see object.ToGoWithCall).
+type Interpreter struct {
+	// Limits applies to each call of Eval and Call, see object.Limits
+	Limits object.Limits
+
+	env *object.Environment
+}
+
+// New creates an interpreter with no bindings
+func New() *Interpreter {
+	return &Interpreter{env: object.NewEnvironment()}
+}
+
+// ParseError is returned for source which doesn't parse
+type ParseError struct {
+	Errors []*parser.ParseError
+}
+
+func (e *ParseError) Error() string {
+	msgs := []string{}
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// RuntimeError is returned when a program fails, other than by exceeding
+// the Limits, which gives an *object.LimitError
+type RuntimeError struct {
+	Message string
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Message
+}
+
+// Eval runs src and returns the value of its last statement, which is nil
+// for a let statement. Its bindings are kept for later programs.
+func (i *Interpreter) Eval(src string) (interface{}, error) {
+	return i.EvalContext(context.Background(), src)
+}
+
+// EvalContext is Eval, stopping when ctx is done
+func (i *Interpreter) EvalContext(ctx context.Context, src string) (interface{}, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+
+	ec := object.NewEvalContext(ctx, i.Limits)
+	return i.toGo(evaluator.EvalWithContext(ec, program, i.env))
+}
+
+// Set binds name to value, replacing any existing binding
+func (i *Interpreter) Set(name string, value interface{}) error {
+	var obj object.Object
+	var err error
+
+	if reflect.ValueOf(value).Kind() == reflect.Func {
+		// named after the binding, for its error messages
+		obj, err = object.Wrap(name, value)
+	} else {
+		obj, err = object.FromGo(value)
+	}
+	if err != nil {
+		return err
+	}
+
+	i.env.Set(name, obj)
+	return nil
+}
+
+// Get returns the value bound to name
+func (i *Interpreter) Get(name string) (interface{}, error) {
+	obj, ok := i.env.Get(name)
+	if !ok {
+		return nil, &RuntimeError{Message: fmt.Sprintf("identifier not found: %s", name)}
+	}
+
+	return i.toGo(obj)
+}
+
+// Call calls the function bound to name, or the builtin of that name, with
+// args and returns the result
+func (i *Interpreter) Call(name string, args ...interface{}) (interface{}, error) {
+	return i.CallContext(context.Background(), name, args...)
+}
+
+// CallContext is Call, stopping when ctx is done
+func (i *Interpreter) CallContext(ctx context.Context, name string, args ...interface{}) (interface{}, error) {
+	fn, ok := i.env.Get(name)
+	if !ok {
+		if builtin := object.Builtins.Lookup(name); builtin != nil {
+			fn = builtin
+		} else {
+			return nil, &RuntimeError{Message: fmt.Sprintf("identifier not found: %s", name)}
+		}
+	}
+
+	objs := make([]object.Object, len(args))
+	for n, a := range args {
+		obj, err := object.FromGo(a)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d to `%s`: %s", n+1, name, err)
+		}
+		objs[n] = obj
+	}
+
+	ec := object.NewEvalContext(ctx, i.Limits)
+	return i.toGo(evaluator.ApplyWithContext(ec, fn, objs...))
+}
+
+// call runs a function returned to Go, with a context of its own
+func (i *Interpreter) call(fn object.Object, args ...object.Object) object.Object {
+	ec := object.NewEvalContext(context.Background(), i.Limits)
+	return evaluator.ApplyWithContext(ec, fn, args...)
+}
+
+// emptyInterface is the type ToGo converts to for the natural Go value
+var emptyInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// toGo converts the result of a program, turning error objects into errors
+func (i *Interpreter) toGo(obj object.Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case nil:
+		return nil, nil
+	case *object.LimitError:
+		return nil, obj
+	case *object.Error:
+		return nil, &RuntimeError{Message: obj.Message}
+	}
+
+	v, err := object.ToGoWithCall(obj, emptyInterface, i.call)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
@@ -0,0 +1,267 @@
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sscaling/monkey/object"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2", int64(3)},
+		{"1.5 * 2", 3.0},
+		{`"mon" + "key"`, "monkey"},
+		{"1 < 2", true},
+		{"if (false) { 1 }", nil},
+		{"let x = 1;", nil},
+		{"[1, [true], {}]", []interface{}{int64(1), []interface{}{true}, map[interface{}]interface{}{}}},
+		{`{"a": 1, 2: "b"}`, map[interface{}]interface{}{"a": int64(1), int64(2): "b"}},
+	}
+
+	for _, tt := range tests {
+		actual, err := New().Eval(tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%q: expected %#v, got %#v", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestBindingsPersist(t *testing.T) {
+	interp := New()
+
+	if _, err := interp.Eval("let add = fn(a, b) { a + b }; let x = 2;"); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	actual, err := interp.Eval("add(x, 3)")
+	if err != nil || actual != int64(5) {
+		t.Errorf("expected 5, got %#v (%v)", actual, err)
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	interp := New()
+
+	values := map[string]interface{}{
+		"n":       42,
+		"ok":      true,
+		"name":    "monkey",
+		"list":    []string{"a", "b"},
+		"scores":  map[string]int{"x": 1},
+		"nothing": nil,
+		"upper":   strings.ToUpper,
+	}
+	for name, v := range values {
+		if err := interp.Set(name, v); err != nil {
+			t.Fatalf("%s: unexpected error %s", name, err)
+		}
+	}
+
+	actual, err := interp.Eval(`[n + 1, !ok, upper(name), len(list), scores["x"], nothing]`)
+	expected := []interface{}{int64(43), false, "MONKEY", int64(2), int64(1), nil}
+	if err != nil || !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v, got %#v (%v)", expected, actual, err)
+	}
+
+	if _, err := interp.Eval("let total = n * 2;"); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if actual, err := interp.Get("total"); err != nil || actual != int64(84) {
+		t.Errorf("expected total to be 84, got %#v (%v)", actual, err)
+	}
+
+	if _, err := interp.Get("missing"); err == nil || err.Error() != "identifier not found: missing" {
+		t.Errorf("expected an error getting an unbound name, got %v", err)
+	}
+
+	if err := interp.Set("bad", struct{}{}); err == nil {
+		t.Errorf("expected an error setting a struct")
+	}
+
+	// a host function's errors are named after its binding
+	_, err = interp.Eval("upper(1)")
+	if err == nil || err.Error() != "argument 1 to `upper`: cannot use INTEGER as string" {
+		t.Errorf("expected an argument error, got %v", err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	interp := New()
+	interp.Set("greeting", "Hello")
+	interp.Set("upper", strings.ToUpper)
+
+	if _, err := interp.Eval(`let greet = fn(name) { upper(greeting + ", " + name) }; let twice = fn(f, x) { f(f(x)) }`); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []interface{}
+		expected interface{}
+	}{
+		{"greet", []interface{}{"monkey"}, "HELLO, MONKEY"},
+		{"twice", []interface{}{func(x int) int { return x * 3 }, 2}, int64(18)},
+		{"len", []interface{}{[]int{1, 2, 3}}, int64(3)},
+	}
+
+	for _, tt := range tests {
+		actual, err := interp.Call(tt.name, tt.args...)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%s: expected %#v, got %#v", tt.name, tt.expected, actual)
+		}
+	}
+
+	errorTests := []struct {
+		name     string
+		args     []interface{}
+		expected string
+	}{
+		{"missing", nil, "identifier not found: missing"},
+		{"greeting", nil, "not a function: STRING"},
+		{"greet", nil, "wrong number of arguments: want=1, got=0"},
+		{"greet", []interface{}{1}, "type mismatch: STRING + INTEGER"},
+		{"greet", []interface{}{struct{}{}}, "argument 1 to `greet`: cannot convert struct {} to an object"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := interp.Call(tt.name, tt.args...)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s%v: expected error %q, got %v", tt.name, tt.args, tt.expected, err)
+		}
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	interp := New()
+	interp.Set("apply", func(f func(int64) int64, x int64) int64 { return f(x) })
+	interp.Set("tryApply", func(f func(int64) (int64, error), x int64) (int64, error) {
+		n, err := f(x)
+		if err != nil {
+			return 0, fmt.Errorf("tryApply: %w", err)
+		}
+		return n, nil
+	})
+
+	if _, err := interp.Eval("let double = fn(x) { x * 2 }; let loop = fn() { loop() };"); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	// Monkey functions come back as funcs, from Get, Eval and within values
+	double, err := interp.Get("double")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	f, ok := double.(func(...interface{}) (interface{}, error))
+	if !ok {
+		t.Fatalf("expected a func, got %T", double)
+	}
+	if n, err := f(21); n != int64(42) || err != nil {
+		t.Errorf("double(21): expected 42, got %v (%v)", n, err)
+	}
+	if _, err := f(); err == nil || err.Error() != "wrong number of arguments: want=1, got=0" {
+		t.Errorf("double(): expected an error, got %v", err)
+	}
+
+	result, _ := interp.Eval("[fn(a, b) { a + b }, len]")
+	fns := result.([]interface{})
+	if n, err := fns[0].(func(...interface{}) (interface{}, error))("a", "b"); n != "ab" || err != nil {
+		t.Errorf(`add("a", "b"): expected "ab", got %v (%v)`, n, err)
+	}
+	if n, err := fns[1].(func(...interface{}) (interface{}, error))([]int{1, 2}); n != int64(2) || err != nil {
+		t.Errorf("len([1, 2]): expected 2, got %v (%v)", n, err)
+	}
+
+	// and Go funcs can take them
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"apply(double, 4)", int64(8)},
+		{"apply(fn(x) { apply(double, x) + 1 }, 4)", int64(9)},
+		{"tryApply(double, 5)", int64(10)},
+	}
+
+	for _, tt := range tests {
+		actual, err := interp.Eval(tt.input)
+		if err != nil || actual != tt.expected {
+			t.Errorf("%q: expected %v, got %v (%v)", tt.input, tt.expected, actual, err)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"apply(fn(x) { x + true }, 1)", "type mismatch: INTEGER + BOOLEAN"},
+		{"tryApply(fn(x) { x + true }, 1)", "tryApply: type mismatch: INTEGER + BOOLEAN"},
+		{`apply(fn(x) { "a" }, 1)`, "cannot use STRING as int64"},
+		{"apply(1, 1)", "argument 1 to `apply`: cannot use INTEGER as func(int64) int64"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := interp.Eval(tt.input)
+		if e, ok := err.(*RuntimeError); !ok || e.Message != tt.expected {
+			t.Errorf("%q: expected error %q, got %T (%v)", tt.input, tt.expected, err, err)
+		}
+	}
+
+	// a limit exceeded within a func stays a limit error
+	interp.Limits = object.Limits{MaxSteps: 1000}
+	var limitErr *object.LimitError
+	for _, input := range []string{"apply(fn(x) { loop() }, 1)", "tryApply(fn(x) { loop() }, 1)"} {
+		if _, err := interp.Eval(input); !errors.As(err, &limitErr) || limitErr.Limit != object.LimitSteps {
+			t.Errorf("%q: expected the step limit to be exceeded, got %v", input, err)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	interp := New()
+
+	_, err := interp.Eval("let = 1;")
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("expected a parse error, got %T (%v)", err, err)
+	}
+
+	_, err = interp.Eval("1 + true")
+	if e, ok := err.(*RuntimeError); !ok || e.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("expected a runtime error, got %T (%v)", err, err)
+	}
+
+	// a host function which panics fails the program, not the host
+	interp.Set("boom", func(a []int) int { return a[5] })
+	_, err = interp.Eval("boom([1])")
+	if e, ok := err.(*RuntimeError); !ok || e.Message != "`boom` panicked: runtime error: index out of range [5] with length 1" {
+		t.Errorf("expected a runtime error, got %T (%v)", err, err)
+	}
+
+	interp.Limits = object.Limits{MaxSteps: 1000}
+	interp.Eval("let loop = fn() { loop() };")
+
+	var limitErr *object.LimitError
+	if _, err := interp.Call("loop"); !errors.As(err, &limitErr) || limitErr.Limit != object.LimitSteps {
+		t.Errorf("expected the step limit to be exceeded, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := interp.EvalContext(ctx, "1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context to be cancelled, got %v", err)
+	}
+}
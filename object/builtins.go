@@ -0,0 +1,244 @@
+package object
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// len(<string, array or hash>) is the number of characters, elements or keys
+func builtinLen(call CallFunc, args ...Object) Object {
+	switch arg := args[0].(type) {
+	case *String:
+		return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+	case *Array:
+		return &Integer{Value: int64(len(arg.Elements))}
+	case *Hash:
+		return &Integer{Value: int64(arg.Len())}
+	default:
+		return newError("argument to `len` not supported, got %s", arg.Type())
+	}
+}
+
+// first(<array>) is the first element, or null if it's empty
+func builtinFirst(call CallFunc, args ...Object) Object {
+	arr, err := arrayArg("first", args)
+	if err != nil {
+		return err
+	}
+
+	if len(arr.Elements) == 0 {
+		return NULL
+	}
+	return arr.Elements[0]
+}
+
+// last(<array>) is the last element, or null if it's empty
+func builtinLast(call CallFunc, args ...Object) Object {
+	arr, err := arrayArg("last", args)
+	if err != nil {
+		return err
+	}
+
+	if len(arr.Elements) == 0 {
+		return NULL
+	}
+	return arr.Elements[len(arr.Elements)-1]
+}
+
+// rest(<array>) is a new array of all but the first element, or null if it's
+// empty
+func builtinRest(call CallFunc, args ...Object) Object {
+	arr, err := arrayArg("rest", args)
+	if err != nil {
+		return err
+	}
+
+	if len(arr.Elements) == 0 {
+		return NULL
+	}
+
+	elements := make([]Object, len(arr.Elements)-1)
+	copy(elements, arr.Elements[1:])
+	return &Array{Elements: elements}
+}
+
+// push(<array>, <value>) is a new array with value added on the end, the
+// original is unchanged
+func builtinPush(call CallFunc, args ...Object) Object {
+	arr, err := arrayArg("push", args)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]Object, len(arr.Elements), len(arr.Elements)+1)
+	copy(elements, arr.Elements)
+	return &Array{Elements: append(elements, args[1])}
+}
+
+// map(<array>, <fn(element)>) is a new array of the results of fn for each
+// element
+func builtinMap(call CallFunc, args ...Object) Object {
+	arr, err := arrayArg("map", args)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]Object, 0, len(arr.Elements))
+	for _, e := range arr.Elements {
+		result := call(args[1], e)
+		if isError(result) {
+			return result
+		}
+		elements = append(elements, result)
+	}
+
+	return &Array{Elements: elements}
+}
+
+// filter(<array>, <fn(element)>) is a new array of the elements for which fn
+// is truthy
+func builtinFilter(call CallFunc, args ...Object) Object {
+	arr, err := arrayArg("filter", args)
+	if err != nil {
+		return err
+	}
+
+	elements := []Object{}
+	for _, e := range arr.Elements {
+		result := call(args[1], e)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			elements = append(elements, e)
+		}
+	}
+
+	return &Array{Elements: elements}
+}
+
+// reduce(<array>, <initial>, <fn(accumulator, element)>) folds the elements
+// from the left, returning initial for an empty array
+func builtinReduce(call CallFunc, args ...Object) Object {
+	arr, err := arrayArg("reduce", args)
+	if err != nil {
+		return err
+	}
+
+	accumulator := args[1]
+	for _, e := range arr.Elements {
+		accumulator = call(args[2], accumulator, e)
+		if isError(accumulator) {
+			return accumulator
+		}
+	}
+
+	return accumulator
+}
+
+// keys(<hash>) is an array of the keys, in the order they were added
+func builtinKeys(call CallFunc, args ...Object) Object {
+	hash, err := hashArg("keys", args)
+	if err != nil {
+		return err
+	}
+
+	elements := []Object{}
+	for _, p := range hash.Pairs() {
+		elements = append(elements, p.Key)
+	}
+	return &Array{Elements: elements}
+}
+
+// values(<hash>) is an array of the values, in the same order as keys
+func builtinValues(call CallFunc, args ...Object) Object {
+	hash, err := hashArg("values", args)
+	if err != nil {
+		return err
+	}
+
+	elements := []Object{}
+	for _, p := range hash.Pairs() {
+		elements = append(elements, p.Value)
+	}
+	return &Array{Elements: elements}
+}
+
+// has(<hash>, <key>) is whether the key is set
+func builtinHas(call CallFunc, args ...Object) Object {
+	hash, err := hashArg("has", args)
+	if err != nil {
+		return err
+	}
+
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	if _, ok := hash.Get(key); ok {
+		return TRUE
+	}
+	return FALSE
+}
+
+// delete(<hash>, <key>) is a new hash without the key, the original is
+// unchanged
+func builtinDelete(call CallFunc, args ...Object) Object {
+	hash, err := hashArg("delete", args)
+	if err != nil {
+		return err
+	}
+
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	deleted := NewHash()
+	for _, p := range hash.Pairs() {
+		if p.Key.(Hashable).HashKey() != key.HashKey() {
+			deleted.Set(p.Key.(Hashable), p.Value)
+		}
+	}
+	return deleted
+}
+
+// arrayArg checks that the first argument is an array, the builtin's arity
+// has already been checked
+func arrayArg(name string, args []Object) (*Array, *Error) {
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+
+	return arr, nil
+}
+
+// hashArg checks that the first argument is a hash
+func hashArg(name string, args []Object) (*Hash, *Error) {
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return nil, newError("argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+
+	return hash, nil
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func isError(obj Object) bool {
+	return obj != nil && obj.Type() == ERROR_OBJ
+}
+
+// null and false are the only falsy values
+func isTruthy(obj Object) bool {
+	switch obj {
+	case NULL, FALSE:
+		return false
+	default:
+		return true
+	}
+}
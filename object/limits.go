@@ -0,0 +1,193 @@
+package object
+
+import (
+	"context"
+	"fmt"
+)
+
+// Limits bounds the work a program can do, a zero field is no limit
+type Limits struct {
+	// MaxSteps is the number of AST nodes the evaluator evaluates, or
+	// instructions the vm executes
+	MaxSteps int64
+
+	// MaxDepth is the number of function calls which can be in progress at
+	// once. Either engine always stops at MaxCallDepth, with the same
+	// LimitDepth error.
+	MaxDepth int
+
+	// MaxAlloc is roughly the number of bytes of strings, arrays and hashes
+	// the program can create in total, i.e. a string counts its length and
+	// an array 16 bytes for each element. Memory which has been freed still
+	// counts.
+	MaxAlloc int64
+}
+
+// MaxCallDepth is the number of function calls which can be in progress at
+// once in either engine, whatever the Limits. Deeper recursion stops the
+// program, rather than exhausting the memory of the Go stack or the vm's.
+const MaxCallDepth = 10000
+
+// Limit identifies which limit stopped a program
+type Limit string
+
+const (
+	LimitSteps   Limit = "steps"
+	LimitDepth   Limit = "depth"
+	LimitAlloc   Limit = "alloc"
+	LimitContext Limit = "context" // the context was cancelled or timed out
+)
+
+// how many steps are taken between checks of the context
+const contextCheckInterval = 1024
+
+// EvalContext tracks a program against its Limits and a context.Context. It
+// is used for a single run, by one goroutine. A nil EvalContext has no
+// limits.
+type EvalContext struct {
+	ctx    context.Context
+	limits Limits
+
+	steps int64
+	depth int
+	alloc int64
+}
+
+// NewEvalContext creates the EvalContext for a run which stops at the given
+// limits, or when ctx is done
+func NewEvalContext(ctx context.Context, limits Limits) *EvalContext {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return &EvalContext{ctx: ctx, limits: limits}
+}
+
+// Steps is the number of steps taken so far
+func (c *EvalContext) Steps() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.steps
+}
+
+// Depth is the number of calls in progress, counted by Enter and Leave
+func (c *EvalContext) Depth() int {
+	if c == nil {
+		return 0
+	}
+	return c.depth
+}
+
+// MaxDepth is the depth limit, for an engine which tracks calls itself
+func (c *EvalContext) MaxDepth() int {
+	if c == nil {
+		return 0
+	}
+	return c.limits.MaxDepth
+}
+
+// Step counts one node or instruction, checking the context every so often
+func (c *EvalContext) Step() *LimitError {
+	if c == nil {
+		return nil
+	}
+
+	c.steps++
+	if c.limits.MaxSteps > 0 && c.steps > c.limits.MaxSteps {
+		return &LimitError{Limit: LimitSteps, Max: c.limits.MaxSteps}
+	}
+
+	if c.steps%contextCheckInterval == 1 {
+		if err := c.ctx.Err(); err != nil {
+			return &LimitError{Limit: LimitContext, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// Enter counts the start of a function call, which Leave must be called
+// to end if there is no error
+func (c *EvalContext) Enter() *LimitError {
+	if c == nil {
+		return nil
+	}
+
+	if c.limits.MaxDepth > 0 && c.depth >= c.limits.MaxDepth {
+		return &LimitError{Limit: LimitDepth, Max: int64(c.limits.MaxDepth)}
+	}
+
+	c.depth++
+	return nil
+}
+
+// Leave counts the end of a function call
+func (c *EvalContext) Leave() {
+	if c != nil {
+		c.depth--
+	}
+}
+
+// Alloc counts the size of a newly created object, see Limits.MaxAlloc
+func (c *EvalContext) Alloc(obj Object) *LimitError {
+	if c == nil {
+		return nil
+	}
+
+	c.alloc += sizeOf(obj)
+	if c.limits.MaxAlloc > 0 && c.alloc > c.limits.MaxAlloc {
+		return &LimitError{Limit: LimitAlloc, Max: c.limits.MaxAlloc}
+	}
+
+	return nil
+}
+
+// sizeOf estimates the memory used by obj itself, not counting its elements
+// which were created separately
+func sizeOf(obj Object) int64 {
+	switch obj := obj.(type) {
+	case *String:
+		return int64(len(obj.Value))
+	case *Array:
+		return 16 * int64(len(obj.Elements))
+	case *Hash:
+		return 64 * int64(obj.Len())
+	default:
+		return 0
+	}
+}
+
+// LimitError is the error of a program stopped by its EvalContext. It is an
+// error object, which the evaluator returns like any other, as well as the
+// error the vm returns.
+type LimitError struct {
+	Limit Limit
+	Max   int64 // the limit which was exceeded, unless it's LimitContext
+	Err   error // the context's error for LimitContext
+}
+
+func (e *LimitError) Type() ObjectType {
+	return ERROR_OBJ
+}
+func (e *LimitError) Inspect() string {
+	return "ERROR: " + e.Error()
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case LimitSteps:
+		return fmt.Sprintf("step limit exceeded: more than %d steps", e.Max)
+	case LimitDepth:
+		return fmt.Sprintf("call depth limit exceeded: more than %d nested calls", e.Max)
+	case LimitAlloc:
+		return fmt.Sprintf("allocation limit exceeded: more than %d bytes", e.Max)
+	default:
+		return fmt.Sprintf("evaluation stopped: %s", e.Err)
+	}
+}
+
+// Unwrap gives the context's error, i.e. for errors.Is(err, context.Canceled)
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
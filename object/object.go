@@ -0,0 +1,349 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sscaling/monkey/ast"
+	"github.com/sscaling/monkey/code"
+)
+
+type ObjectType string
+
+const (
+	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	STRING_OBJ       = "STRING"
+	NULL_OBJ         = "NULL"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	BUILTIN_OBJ      = "BUILTIN"
+
+	// only a constant of the compiled program, the vm's function values are
+	// closures, which are FUNCTION_OBJ as in the evaluator
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+)
+
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+// there is only ever one instance of each of these, so they can be compared
+// by reference
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// -------- INTEGER -------
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType {
+	return INTEGER_OBJ
+}
+func (i *Integer) Inspect() string {
+	return fmt.Sprintf("%d", i.Value)
+}
+
+// -------- FLOAT -------
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
+// Inspect always includes a point or exponent, so 2.0 doesn't look like 2
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// -------- BOOLEAN -------
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType {
+	return BOOLEAN_OBJ
+}
+func (b *Boolean) Inspect() string {
+	return fmt.Sprintf("%t", b.Value)
+}
+
+// -------- STRING -------
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType {
+	return STRING_OBJ
+}
+func (s *String) Inspect() string {
+	return s.Value
+}
+
+// -------- NULL -------
+
+type Null struct{}
+
+func (n *Null) Type() ObjectType {
+	return NULL_OBJ
+}
+func (n *Null) Inspect() string {
+	return "null"
+}
+
+// -------- RETURN VALUE -------
+
+// ReturnValue wraps the value of a return statement so evaluation can stop
+// unwinding at the enclosing function (or program)
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType {
+	return RETURN_VALUE_OBJ
+}
+func (rv *ReturnValue) Inspect() string {
+	return rv.Value.Inspect()
+}
+
+// -------- ERROR -------
+
+type Error struct {
+	Message string
+}
+
+func (e *Error) Type() ObjectType {
+	return ERROR_OBJ
+}
+func (e *Error) Inspect() string {
+	return "ERROR: " + e.Message
+}
+
+// -------- FUNCTION -------
+
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (f *Function) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+func (f *Function) Inspect() string {
+	return inspectFunction(f.Parameters, f.Body)
+}
+
+// inspectFunction gives a function as its source, the same in both engines
+func inspectFunction(parameters []*ast.Identifier, body *ast.BlockStatement) string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	if body != nil {
+		out.WriteString(body.String())
+	}
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// -------- COMPILED FUNCTION -------
+
+// CompiledFunction is the bytecode equivalent of Function, used by the vm
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+
+	// the function literal it was compiled from, for Inspect
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJ
+}
+func (cf *CompiledFunction) Inspect() string {
+	return inspectFunction(cf.Parameters, cf.Body)
+}
+
+// -------- CLOSURE -------
+
+// Closure is a CompiledFunction together with the values of the free
+// variables it captured when it was created. Every function value in the vm
+// is a closure, even those which capture nothing.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+func (c *Closure) Inspect() string {
+	return c.Fn.Inspect()
+}
+
+// -------- ARRAY -------
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType {
+	return ARRAY_OBJ
+}
+func (a *Array) Inspect() string {
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// -------- HASH -------
+
+// HashKey identifies a key of a Hash, keys are the same when their HashKeys
+// are equal. Strings are kept whole rather than hashed, so no two collide.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+	Str   string
+}
+
+// Hashable is implemented by the objects which can be used as hash keys
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	return HashKey{Type: s.Type(), Str: s.Value}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash keeps its keys in the order they were first set, so that printing or
+// iterating over it is reproducible
+type Hash struct {
+	pairs map[HashKey]HashPair
+	keys  []HashKey
+}
+
+func NewHash() *Hash {
+	return &Hash{pairs: make(map[HashKey]HashPair)}
+}
+
+func (h *Hash) Type() ObjectType {
+	return HASH_OBJ
+}
+func (h *Hash) Inspect() string {
+	pairs := []string{}
+	for _, p := range h.Pairs() {
+		pairs = append(pairs, p.Key.Inspect()+": "+p.Value.Inspect())
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Set binds key to value, a key which is already set keeps its place
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if _, ok := h.pairs[hashKey]; !ok {
+		h.keys = append(h.keys, hashKey)
+	}
+	h.pairs[hashKey] = HashPair{Key: key, Value: value}
+}
+
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+func (h *Hash) Len() int {
+	return len(h.keys)
+}
+
+// Pairs returns the keys and values in order
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, len(h.keys))
+	for i, k := range h.keys {
+		pairs[i] = h.pairs[k]
+	}
+	return pairs
+}
+
+// -------- BUILTIN -------
+
+// CallFunc calls a function value, letting a builtin such as map call back
+// into whichever of the evaluator or vm is running it
+type CallFunc func(fn Object, args ...Object) Object
+
+type BuiltinFunction func(call CallFunc, args ...Object) Object
+
+type Builtin struct {
+	Name  string
+	Arity int // number of arguments, or Variadic
+	Fn    BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType {
+	return BUILTIN_OBJ
+}
+func (b *Builtin) Inspect() string {
+	return "builtin function " + b.Name
+}
+
+// Call checks the number of arguments against the arity of the builtin, then
+// calls it
+func (b *Builtin) Call(call CallFunc, args ...Object) Object {
+	if b.Arity != Variadic && len(args) != b.Arity {
+		return &Error{Message: fmt.Sprintf("wrong number of arguments: want=%d, got=%d", b.Arity, len(args))}
+	}
+
+	return b.Fn(call, args...)
+}
@@ -0,0 +1,477 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+
+	// what a function converts to for an empty interface type
+	nativeFuncType = reflect.TypeOf((func(...interface{}) (interface{}, error))(nil))
+)
+
+// Wrap adapts a plain Go function, i.e. func(int, string) (bool, error), to a
+// builtin called name. Arguments are converted with ToGoWithCall, so a func
+// parameter can be given a Monkey function, and the result with FromGo. The
+// function can return nothing, a value, an error, or a value and an error. A
+// panic is returned as an error. The arity is the number of parameters, or
+// Variadic.
+func Wrap(name string, fn interface{}) (*Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return nil, fmt.Errorf("builtin %s: expected a function, got %T", name, fn)
+	}
+
+	t := v.Type()
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	if t.NumOut() > 2 || (t.NumOut() == 2 && !returnsError) {
+		return nil, fmt.Errorf("builtin %s: %s must return at most a value and an error", name, t)
+	}
+
+	arity := t.NumIn()
+	if t.IsVariadic() {
+		arity = Variadic
+	}
+
+	host := func(call CallFunc, args ...Object) (Object, error) {
+		if t.IsVariadic() && len(args) < t.NumIn()-1 {
+			return nil, fmt.Errorf("wrong number of arguments: want at least %d, got=%d", t.NumIn()-1, len(args))
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, a := range args {
+			var param reflect.Type
+			if t.IsVariadic() && i >= t.NumIn()-1 {
+				param = t.In(t.NumIn() - 1).Elem()
+			} else {
+				param = t.In(i)
+			}
+
+			arg, err := ToGoWithCall(a, param, call)
+			if err != nil {
+				return nil, fmt.Errorf("argument %d to `%s`: %s", i+1, name, err)
+			}
+			in[i] = arg
+		}
+
+		out, err := callHost(name, v, in)
+		if err != nil {
+			return nil, err
+		}
+
+		if returnsError {
+			if err := out[len(out)-1]; !err.IsNil() {
+				return nil, err.Interface().(error)
+			}
+			out = out[:len(out)-1]
+		}
+
+		if len(out) == 0 {
+			return NULL, nil
+		}
+		return fromGo(out[0])
+	}
+
+	builtin := func(call CallFunc, args ...Object) Object {
+		return hostResult(host(call, args...))
+	}
+
+	return &Builtin{Name: name, Arity: arity, Fn: builtin}, nil
+}
+
+// callHost calls fn, turning a panic into an error so that a host function can't
+// bring down the program embedding the interpreter
+func callHost(name string, fn reflect.Value, in []reflect.Value) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(callbackError); ok {
+				// from a Monkey function the host function called
+				err = e.err
+				return
+			}
+			err = fmt.Errorf("`%s` panicked: %v", name, r)
+		}
+	}()
+
+	return fn.Call(in), nil
+}
+
+// FromGo converts a Go value to the equivalent object. Numbers, booleans,
+// strings, slices, maps with integer, boolean or string keys, pointers to any
+// of those and functions (see Wrap) are supported, as are objects themselves.
+// Map keys are sorted, so the hash is always in the same order.
+func FromGo(v interface{}) (Object, error) {
+	return fromGo(reflect.ValueOf(v))
+}
+
+func fromGo(v reflect.Value) (Object, error) {
+	if !v.IsValid() {
+		return NULL, nil
+	}
+
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return NULL, nil
+	}
+
+	if obj, ok := v.Interface().(Object); ok {
+		return obj, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > 1<<63-1 {
+			return nil, fmt.Errorf("%d overflows INTEGER", v.Uint())
+		}
+		return &Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Interface, reflect.Ptr:
+		return fromGo(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NULL, nil
+		}
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			e, err := fromGo(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = e
+		}
+		return &Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return fromGoMap(v)
+	case reflect.Func:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return Wrap("", v.Interface())
+	default:
+		return nil, fmt.Errorf("cannot convert %s to an object", v.Type())
+	}
+}
+
+func fromGoMap(v reflect.Value) (Object, error) {
+	type pair struct{ key, value Object }
+
+	pairs := make([]pair, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		key, err := fromGo(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := fromGo(v.MapIndex(k))
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair{key, value})
+	}
+
+	for _, p := range pairs {
+		if _, ok := p.key.(Hashable); !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", p.key.Type())
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return lessKey(pairs[i].key, pairs[j].key)
+	})
+
+	hash := NewHash()
+	for _, p := range pairs {
+		hash.Set(p.key.(Hashable), p.value)
+	}
+	return hash, nil
+}
+
+// lessKey orders hash keys by type, then by value
+func lessKey(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	default:
+		return false
+	}
+}
+
+// ToGo converts obj to a Go value of type t. Integers convert to any integer
+// type they fit, integers and floats to float types, arrays to slices and
+// hashes to maps, with their elements converted in turn. For an empty
+// interface type the natural Go value is used: int64, float64, bool,
+// string, []interface{}, map[interface{}]interface{}, nil for null, or the
+// object itself for anything else. Functions aren't converted, see
+// ToGoWithCall.
+func ToGo(obj Object, t reflect.Type) (reflect.Value, error) {
+	return ToGoWithCall(obj, t, nil)
+}
+
+// ToGoWithCall is ToGo, also converting functions and builtins to a func type,
+// or to a func(...interface{}) (interface{}, error) for an empty interface
+// type. The func runs the function with call, so can only be used while call
+// can, i.e. during the builtin it was given to. Its arguments are converted
+// with FromGo and the result with ToGoWithCall. If the function fails, with
+// an *LimitError or an error with the message of an error object, the error
+// is returned when the func type has an error result and is otherwise a
+// panic, which Wrap recovers as the error of the builtin.
+func ToGoWithCall(obj Object, t reflect.Type, call CallFunc) (reflect.Value, error) {
+	if t == objectType {
+		return reflect.ValueOf(&obj).Elem(), nil
+	}
+
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		if obj == NULL {
+			return reflect.Zero(t), nil
+		}
+		native, err := toNative(obj, call)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v := reflect.New(t).Elem()
+		v.Set(reflect.ValueOf(native))
+		return v, nil
+	}
+
+	mismatch := fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+	v := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*Boolean)
+		if !ok {
+			return v, mismatch
+		}
+		v.SetBool(b.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*Integer)
+		if !ok {
+			return v, mismatch
+		}
+		if v.OverflowInt(i.Value) {
+			return v, fmt.Errorf("%d overflows %s", i.Value, t)
+		}
+		v.SetInt(i.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := obj.(*Integer)
+		if !ok {
+			return v, mismatch
+		}
+		if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+			return v, fmt.Errorf("%d overflows %s", i.Value, t)
+		}
+		v.SetUint(uint64(i.Value))
+	case reflect.Float32, reflect.Float64:
+		switch n := obj.(type) {
+		case *Integer:
+			v.SetFloat(float64(n.Value))
+		case *Float:
+			v.SetFloat(n.Value)
+		default:
+			return v, mismatch
+		}
+	case reflect.String:
+		s, ok := obj.(*String)
+		if !ok {
+			return v, mismatch
+		}
+		v.SetString(s.Value)
+	case reflect.Slice:
+		arr, ok := obj.(*Array)
+		if !ok {
+			return v, mismatch
+		}
+		v.Set(reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements)))
+		for i, e := range arr.Elements {
+			ev, err := ToGoWithCall(e, t.Elem(), call)
+			if err != nil {
+				return v, err
+			}
+			v.Index(i).Set(ev)
+		}
+	case reflect.Map:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return v, mismatch
+		}
+		v.Set(reflect.MakeMapWithSize(t, hash.Len()))
+		for _, p := range hash.Pairs() {
+			key, err := ToGoWithCall(p.Key, t.Key(), call)
+			if err != nil {
+				return v, err
+			}
+			value, err := ToGoWithCall(p.Value, t.Elem(), call)
+			if err != nil {
+				return v, err
+			}
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Func:
+		if call == nil || !isFunction(obj) {
+			return v, mismatch
+		}
+		fn, err := goFunc(obj, t, call)
+		if err != nil {
+			return v, err
+		}
+		v.Set(fn)
+	default:
+		if reflect.TypeOf(obj).AssignableTo(t) {
+			// i.e. *Hash, or an interface which the object implements
+			v.Set(reflect.ValueOf(obj))
+			return v, nil
+		}
+		return v, mismatch
+	}
+
+	return v, nil
+}
+
+// toNative gives the Go value for obj, as described by ToGoWithCall
+func toNative(obj Object, call CallFunc) (interface{}, error) {
+	if call != nil && isFunction(obj) {
+		fn, err := goFunc(obj, nativeFuncType, call)
+		if err != nil {
+			return nil, err
+		}
+		return fn.Interface(), nil
+	}
+
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value, nil
+	case *Float:
+		return obj.Value, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Null:
+		return nil, nil
+	case *Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, e := range obj.Elements {
+			native, err := toNative(e, call)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = native
+		}
+		return elements, nil
+	case *Hash:
+		m := make(map[interface{}]interface{}, obj.Len())
+		for _, p := range obj.Pairs() {
+			key, err := toNative(p.Key, call)
+			if err != nil {
+				return nil, err
+			}
+			value, err := toNative(p.Value, call)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	case *Error:
+		return nil, errors.New(obj.Message)
+	default:
+		return obj, nil
+	}
+}
+
+func isFunction(obj Object) bool {
+	switch obj.(type) {
+	case *Function, *Closure, *Builtin:
+		return true
+	}
+	return false
+}
+
+// callbackError is the panic of a func from goFunc which has no error result
+type callbackError struct {
+	err error
+}
+
+// goFunc makes a func of type t which runs fn with call
+func goFunc(fn Object, t reflect.Type, call CallFunc) (reflect.Value, error) {
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	if t.NumOut() > 2 || (t.NumOut() == 2 && !returnsError) {
+		return reflect.Value{}, fmt.Errorf("cannot use %s as %s, which must return at most a value and an error", fn.Type(), t)
+	}
+
+	return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+
+		fail := func(err error) []reflect.Value {
+			if !returnsError {
+				panic(callbackError{err})
+			}
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+			return out
+		}
+
+		params := in
+		if t.IsVariadic() {
+			variadic := in[len(in)-1]
+			params = append([]reflect.Value(nil), in[:len(in)-1]...)
+			for i := 0; i < variadic.Len(); i++ {
+				params = append(params, variadic.Index(i))
+			}
+		}
+
+		args := make([]Object, len(params))
+		for i, p := range params {
+			arg, err := fromGo(p)
+			if err != nil {
+				return fail(fmt.Errorf("argument %d: %s", i+1, err))
+			}
+			args[i] = arg
+		}
+
+		result := call(fn, args...)
+		switch result := result.(type) {
+		case *LimitError:
+			return fail(result)
+		case *Error:
+			return fail(errors.New(result.Message))
+		}
+
+		if t.NumOut() == 0 || (t.NumOut() == 1 && returnsError) {
+			return out
+		}
+
+		v, err := ToGoWithCall(result, t.Out(0), call)
+		if err != nil {
+			return fail(err)
+		}
+		out[0] = v
+		return out
+	}), nil
+}
@@ -0,0 +1,161 @@
+package object
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// Variadic is the Arity of a builtin which takes any number of arguments
+const Variadic = -1
+
+// HostFunction is a builtin written in Go which doesn't need to call back
+// into the program. A nil result is null, and an error stops the program.
+type HostFunction func(args ...Object) (Object, error)
+
+// BuiltinOption sets optional metadata on a builtin being registered
+type BuiltinOption func(*Builtin)
+
+// WithArity has calls checked for the given number of arguments, without it
+// a builtin registered from a HostFunction is variadic
+func WithArity(n int) BuiltinOption {
+	return func(b *Builtin) {
+		b.Arity = n
+	}
+}
+
+// Registry holds the builtin functions, which are numbered in the order they
+// were added. Names are resolved against it only when no binding of the same
+// name exists. It isn't safe to register builtins while programs are running.
+type Registry struct {
+	// Out is where puts writes
+	Out io.Writer
+
+	builtins []*Builtin
+	index    map[string]int
+}
+
+// Builtins is the registry used by the evaluator, compiler and vm. Register
+// any host functions before compiling the programs which call them.
+var Builtins = NewRegistry()
+
+// NewRegistry creates a registry with the standard builtins
+func NewRegistry() *Registry {
+	r := &Registry{Out: os.Stdout, index: make(map[string]int)}
+
+	r.Add(&Builtin{Name: "len", Arity: 1, Fn: builtinLen})
+	r.Add(&Builtin{Name: "first", Arity: 1, Fn: builtinFirst})
+	r.Add(&Builtin{Name: "last", Arity: 1, Fn: builtinLast})
+	r.Add(&Builtin{Name: "rest", Arity: 1, Fn: builtinRest})
+	r.Add(&Builtin{Name: "push", Arity: 2, Fn: builtinPush})
+	r.Add(&Builtin{Name: "map", Arity: 2, Fn: builtinMap})
+	r.Add(&Builtin{Name: "filter", Arity: 2, Fn: builtinFilter})
+	r.Add(&Builtin{Name: "reduce", Arity: 3, Fn: builtinReduce})
+	r.Add(&Builtin{Name: "keys", Arity: 1, Fn: builtinKeys})
+	r.Add(&Builtin{Name: "values", Arity: 1, Fn: builtinValues})
+	r.Add(&Builtin{Name: "has", Arity: 2, Fn: builtinHas})
+	r.Add(&Builtin{Name: "delete", Arity: 2, Fn: builtinDelete})
+	r.Register("puts", r.puts)
+	r.Register("type", builtinType, WithArity(1))
+
+	return r
+}
+
+// Add registers b, replacing any builtin of the same name but keeping its
+// number
+func (r *Registry) Add(b *Builtin) {
+	if i, ok := r.index[b.Name]; ok {
+		r.builtins[i] = b
+		return
+	}
+
+	r.index[b.Name] = len(r.builtins)
+	r.builtins = append(r.builtins, b)
+}
+
+// Register adds a Go function as the builtin called name
+func (r *Registry) Register(name string, fn func(args ...Object) (Object, error), opts ...BuiltinOption) *Builtin {
+	b := &Builtin{Name: name, Arity: Variadic, Fn: hostBuiltin(fn)}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	r.Add(b)
+	return b
+}
+
+// RegisterFunc adds a plain Go function as the builtin called name, see Wrap
+func (r *Registry) RegisterFunc(name string, fn interface{}) error {
+	b, err := Wrap(name, fn)
+	if err != nil {
+		return err
+	}
+
+	r.Add(b)
+	return nil
+}
+
+// Lookup returns the builtin called name, or nil if there isn't one
+func (r *Registry) Lookup(name string) *Builtin {
+	if i, ok := r.index[name]; ok {
+		return r.builtins[i]
+	}
+
+	return nil
+}
+
+// At returns the builtin numbered i
+func (r *Registry) At(i int) *Builtin {
+	return r.builtins[i]
+}
+
+// All returns the builtins in the order they are numbered
+func (r *Registry) All() []*Builtin {
+	return append([]*Builtin(nil), r.builtins...)
+}
+
+func hostBuiltin(fn HostFunction) BuiltinFunction {
+	return func(call CallFunc, args ...Object) Object {
+		return hostResult(fn(args...))
+	}
+}
+
+// hostResult is the object for what a host function returned. A limit
+// exceeded by a function it called stays a *LimitError.
+func hostResult(result Object, err error) Object {
+	if err != nil {
+		var limitErr *LimitError
+		if errors.As(err, &limitErr) {
+			return limitErr
+		}
+		return &Error{Message: err.Error()}
+	}
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// puts(<value>, ...) writes each value on a line of its own
+func (r *Registry) puts(args ...Object) (Object, error) {
+	var out strings.Builder
+	for _, a := range args {
+		out.WriteString(a.Inspect())
+		out.WriteString("\n")
+	}
+
+	_, err := io.WriteString(r.Out, out.String())
+	return nil, err
+}
+
+// type(<value>) is the name of the type of the value, i.e. "INTEGER"
+func builtinType(args ...Object) (Object, error) {
+	t := args[0].Type()
+	if t == COMPILED_FUNCTION_OBJ {
+		// the same as in the evaluator
+		t = FUNCTION_OBJ
+	}
+
+	return &String{Value: string(t)}, nil
+}
@@ -0,0 +1,253 @@
+package object
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// callBuiltin calls b as the engines do, without the ability to call back
+func callBuiltin(b *Builtin, args ...Object) Object {
+	return b.Call(nil, args...)
+}
+
+func TestRegister(t *testing.T) {
+	r := NewRegistry()
+	numbered := len(r.All())
+
+	sum := func(args ...Object) (Object, error) {
+		var total int64
+		for _, a := range args {
+			i, ok := a.(*Integer)
+			if !ok {
+				return nil, errors.New("sum wants integers")
+			}
+			total += i.Value
+		}
+		return &Integer{Value: total}, nil
+	}
+
+	b := r.Register("sum", sum)
+	if b.Arity != Variadic || r.Lookup("sum") != b || r.At(numbered) != b {
+		t.Fatalf("sum not registered as variadic builtin %d: %+v", numbered, b)
+	}
+
+	tests := []struct {
+		args     []Object
+		expected string
+	}{
+		{nil, "0"},
+		{[]Object{&Integer{Value: 1}, &Integer{Value: 2}}, "3"},
+		{[]Object{TRUE}, "ERROR: sum wants integers"},
+	}
+
+	for _, tt := range tests {
+		if actual := callBuiltin(b, tt.args...).Inspect(); actual != tt.expected {
+			t.Errorf("sum%v: expected %s, got %s", tt.args, tt.expected, actual)
+		}
+	}
+
+	// registering a name again replaces the builtin, keeping its number
+	pair := r.Register("sum", func(args ...Object) (Object, error) { return nil, nil }, WithArity(2))
+	if r.At(numbered) != pair || len(r.All()) != numbered+1 {
+		t.Errorf("expected sum to be replaced in place")
+	}
+
+	if actual := callBuiltin(pair, TRUE).Inspect(); actual != "ERROR: wrong number of arguments: want=2, got=1" {
+		t.Errorf("expected an arity error, got %s", actual)
+	}
+	if actual := callBuiltin(pair, TRUE, TRUE); actual != NULL {
+		t.Errorf("expected a nil result to be null, got %s", actual.Inspect())
+	}
+
+	if r.Lookup("nope") != nil {
+		t.Errorf("expected no builtin called nope")
+	}
+}
+
+func TestStandardBuiltins(t *testing.T) {
+	r := NewRegistry()
+
+	var out bytes.Buffer
+	r.Out = &out
+
+	result := callBuiltin(r.Lookup("puts"), &String{Value: "hello"}, &Integer{Value: 1}, NULL)
+	if result != NULL || out.String() != "hello\n1\nnull\n" {
+		t.Errorf("puts gave %s, writing %q", result.Inspect(), out.String())
+	}
+
+	tests := []struct {
+		arg      Object
+		expected string
+	}{
+		{&Integer{Value: 1}, "INTEGER"},
+		{&Array{}, "ARRAY"},
+		{NewHash(), "HASH"},
+		{&CompiledFunction{}, "FUNCTION"},
+		{&Closure{}, "FUNCTION"},
+		{r.Lookup("len"), "BUILTIN"},
+	}
+
+	for _, tt := range tests {
+		if actual := callBuiltin(r.Lookup("type"), tt.arg).Inspect(); actual != tt.expected {
+			t.Errorf("type(%s): expected %s, got %s", tt.arg.Inspect(), tt.expected, actual)
+		}
+	}
+
+	if actual := callBuiltin(r.Lookup("len"), &String{Value: "héllo"}).Inspect(); actual != "5" {
+		t.Errorf("len: expected 5, got %s", actual)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		fn       interface{}
+		args     []Object
+		arity    int
+		expected string
+	}{
+		{strings.ToUpper, []Object{&String{Value: "abc"}}, 1, "ABC"},
+		{strings.Repeat, []Object{&String{Value: "ab"}, &Integer{Value: 2}}, 2, "abab"},
+		{strings.Repeat, []Object{&String{Value: "ab"}, TRUE}, 2, "ERROR: argument 2 to `f`: cannot use BOOLEAN as int"},
+		{func(a int8) int8 { return a }, []Object{&Integer{Value: 300}}, 1, "ERROR: argument 1 to `f`: 300 overflows int8"},
+		{func(a float64) float64 { return a / 2 }, []Object{&Integer{Value: 3}}, 1, "1.5"},
+		{func(xs []int) int { return len(xs) }, []Object{&Array{Elements: []Object{&Integer{Value: 1}}}}, 1, "1"},
+		{func(m map[string]int) []string { return []string{"x"} }, []Object{NewHash()}, 1, "[x]"},
+		{func(m map[string]int) map[string]int { return map[string]int{"b": 2, "a": 1} }, []Object{NewHash()}, 1, "{a: 1, b: 2}"},
+		{func(v interface{}) string { return reflect.TypeOf(v).String() }, []Object{&Array{Elements: []Object{TRUE}}}, 1, "[]interface {}"},
+		{func(o Object) Object { return o }, []Object{NULL}, 1, "null"},
+		{func(sep string, xs ...string) string { return strings.Join(xs, sep) }, []Object{&String{Value: "-"}, &String{Value: "a"}, &String{Value: "b"}}, Variadic, "a-b"},
+		{func(sep string, xs ...string) string { return "" }, nil, Variadic, "ERROR: wrong number of arguments: want at least 1, got=0"},
+		{func() error { return errors.New("failed") }, nil, 0, "ERROR: failed"},
+		{func() (int, error) { return 1, nil }, nil, 0, "1"},
+		{func() {}, nil, 0, "null"},
+		{func() *int { return nil }, nil, 0, "null"},
+		{func() uint64 { return 1 << 63 }, nil, 0, "ERROR: 9223372036854775808 overflows INTEGER"},
+		{func(a []int) int { return a[5] }, []Object{&Array{Elements: []Object{&Integer{Value: 1}}}}, 1, "ERROR: `f` panicked: runtime error: index out of range [5] with length 1"},
+		{func() { panic("boom") }, nil, 0, "ERROR: `f` panicked: boom"},
+	}
+
+	for _, tt := range tests {
+		b, err := Wrap("f", tt.fn)
+		if err != nil {
+			t.Errorf("%T: unexpected error %s", tt.fn, err)
+			continue
+		}
+
+		if b.Arity != tt.arity {
+			t.Errorf("%T: expected arity %d, got %d", tt.fn, tt.arity, b.Arity)
+		}
+
+		if actual := callBuiltin(b, tt.args...).Inspect(); actual != tt.expected {
+			t.Errorf("%T: expected %s, got %s", tt.fn, tt.expected, actual)
+		}
+	}
+
+	invalid := []interface{}{
+		1,
+		func() (int, int) { return 1, 2 },
+		func() (int, int, error) { return 1, 2, nil },
+	}
+
+	for _, fn := range invalid {
+		if _, err := Wrap("f", fn); err == nil {
+			t.Errorf("%T: expected an error", fn)
+		}
+	}
+}
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{uint8(7), "7"},
+		{2.5, "2.5"},
+		{true, "true"},
+		{"s", "s"},
+		{[]interface{}{1, "a", nil}, "[1, a, null]"},
+		{[2]bool{true, false}, "[true, false]"},
+		{map[int]string{10: "b", 2: "a"}, "{2: a, 10: b}"},
+		{map[interface{}]int{"a": 1, 1: 2, true: 3}, "{true: 3, 1: 2, a: 1}"},
+		{&Integer{Value: 1}, "1"},
+		{strings.ToUpper, "builtin function "},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.value)
+		if err != nil {
+			t.Errorf("%#v: unexpected error %s", tt.value, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("%#v: expected %s, got %s", tt.value, tt.expected, obj.Inspect())
+		}
+	}
+
+	if _, err := FromGo(struct{}{}); err == nil {
+		t.Errorf("expected an error converting a struct")
+	}
+	if _, err := FromGo(map[float64]int{1.5: 1}); err == nil {
+		t.Errorf("expected an error converting a map with float keys")
+	}
+}
+
+func TestToGo(t *testing.T) {
+	hash := NewHash()
+	hash.Set(&String{Value: "a"}, &Integer{Value: 1})
+
+	tests := []struct {
+		obj      Object
+		expected interface{}
+	}{
+		{&Integer{Value: 3}, int(3)},
+		{&Integer{Value: 3}, uint16(3)},
+		{&Integer{Value: 3}, float32(3)},
+		{&Float{Value: 0.5}, 0.5},
+		{&String{Value: "x"}, "x"},
+		{&Array{Elements: []Object{&Integer{Value: 1}}}, []int64{1}},
+		{hash, map[string]int{"a": 1}},
+		{hash, hash},
+	}
+
+	for _, tt := range tests {
+		v, err := ToGo(tt.obj, reflect.TypeOf(tt.expected))
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", tt.obj.Inspect(), err)
+			continue
+		}
+		if !reflect.DeepEqual(v.Interface(), tt.expected) {
+			t.Errorf("%s: expected %#v, got %#v", tt.obj.Inspect(), tt.expected, v.Interface())
+		}
+	}
+
+	var empty interface{}
+	natural := []struct {
+		obj      Object
+		expected interface{}
+	}{
+		{NULL, nil},
+		{&Integer{Value: 3}, int64(3)},
+		{&Array{Elements: []Object{TRUE, NULL}}, []interface{}{true, nil}},
+		{hash, map[interface{}]interface{}{"a": int64(1)}},
+	}
+
+	for _, tt := range natural {
+		v, err := ToGo(tt.obj, reflect.TypeOf(&empty).Elem())
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", tt.obj.Inspect(), err)
+			continue
+		}
+		if !reflect.DeepEqual(v.Interface(), tt.expected) {
+			t.Errorf("%s: expected %#v, got %#v", tt.obj.Inspect(), tt.expected, v.Interface())
+		}
+	}
+
+	if _, err := ToGo(&Integer{Value: -1}, reflect.TypeOf(uint(0))); err == nil {
+		t.Errorf("expected an error converting -1 to uint")
+	}
+}
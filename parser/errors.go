@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/sscaling/monkey/lexer"
+	"github.com/sscaling/monkey/token"
+)
+
+// Codes for the problems the parser can report. These are stable, so tools can
+// rely on them. Problems found by the lexer keep the lexer's codes.
+const (
+	ErrUnexpectedToken = "P001" // a specific token was expected
+	ErrNoPrefixParseFn = "P002" // the token can't start an expression
+	ErrInvalidInteger  = "P003"
+	ErrUnclosedBlock   = "P004"
+	ErrInvalidFloat    = "P005"
+	ErrIntegerOverflow = "P006"
+	ErrFloatOverflow   = "P007"
+)
+
+// ParseError is a problem with the program, located at the token which
+// caused it
+type ParseError struct {
+	Code    string
+	Message string
+
+	Line   int
+	Column int
+	Offset int // in bytes from the start of the input
+
+	Expected token.TokenType // empty when no particular token was expected
+	Actual   token.Token
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// newParseError creates an error at actual, base is that of the lexer which
+// produced it (see token.FileSet)
+func newParseError(code string, base int, actual token.Token, format string, a ...interface{}) *ParseError {
+	return &ParseError{
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+		Line:    actual.Line,
+		Column:  actual.Column,
+		Offset:  actual.Position - base,
+		Actual:  actual,
+	}
+}
+
+func fromLexerError(err lexer.Error, actual token.Token) *ParseError {
+	return &ParseError{
+		Code:    err.Code,
+		Message: err.Message,
+		Line:    err.Line,
+		Column:  err.Column,
+		Offset:  err.Offset,
+		Actual:  actual,
+	}
+}
+
+// describe gives a token as it reads in an error message, with the literal
+// only where it adds something to the type, i.e. IDENT "foo" but not ; ";"
+func describe(t token.Token) string {
+	if t.Type == token.EOF || string(t.Type) == t.Literal {
+		return string(t.Type)
+	}
+
+	return fmt.Sprintf("%s %q", t.Type, t.Literal)
+}
+
+// RenderError formats err with the line of src it was found on, and a caret
+// under the column, i.e.
+//
+//	error[P001] 1:15: expected next token to be ), got ; instead
+//	  1 | let x = (1 + 2;
+//	    |               ^
+func RenderError(src string, err *ParseError) string {
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, "error[%s] %s\n", err.Code, err.Error())
+
+	offset := err.Offset
+	if offset > len(src) {
+		offset = len(src)
+	}
+
+	start := strings.LastIndexByte(src[:offset], '\n') + 1
+	end := strings.IndexByte(src[offset:], '\n')
+	if end < 0 {
+		end = len(src)
+	} else {
+		end += offset
+	}
+	line := strings.TrimRight(src[start:end], "\r")
+
+	gutter := fmt.Sprintf("%d", err.Line)
+	fmt.Fprintf(&out, "  %s | %s\n", gutter, line)
+
+	// keep any tabs so the caret lines up however they are displayed, and
+	// a space for each column the other characters take up
+	var padding strings.Builder
+	for _, r := range src[start:offset] {
+		if r == '\t' {
+			padding.WriteRune(r)
+		} else {
+			padding.WriteString(strings.Repeat(" ", displayWidth(r)))
+		}
+	}
+	fmt.Fprintf(&out, "  %s | %s^\n", strings.Repeat(" ", len(gutter)), padding.String())
+
+	return out.String()
+}
+
+// displayWidth is the number of columns a terminal shows r in: none for a
+// carriage return or a combining mark, two for a wide East Asian character or
+// an emoji, otherwise one
+func displayWidth(r rune) int {
+	switch {
+	case r == '\r' || unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case r >= 0x1100 && r <= 0x115f, // Hangul Jamo
+		r >= 0x2e80 && r <= 0xa4cf && r != 0x303f, // CJK up to Yi
+		r >= 0xac00 && r <= 0xd7a3,                // Hangul syllables
+		r >= 0xf900 && r <= 0xfaff,                // CJK compatibility ideographs
+		r >= 0xfe30 && r <= 0xfe4f,                // CJK compatibility forms
+		r >= 0xff00 && r <= 0xff60,                // fullwidth forms
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f, // emoji
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd: // CJK extensions
+		return 2
+	default:
+		return 1
+	}
+}
+
+// RenderErrors renders each of errs, in order
+func RenderErrors(src string, errs []*ParseError) string {
+	var out bytes.Buffer
+
+	for _, err := range errs {
+		out.WriteString(RenderError(src, err))
+	}
+
+	return out.String()
+}
@@ -0,0 +1,232 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/sscaling/monkey/lexer"
+	"github.com/sscaling/monkey/token"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     string
+		message  string
+		line     int
+		column   int
+		offset   int
+		expected token.TokenType
+		actual   token.TokenType
+	}{
+		{"let x = (1 + 2;", ErrUnexpectedToken, "expected next token to be ), got ; instead", 1, 15, 14, token.RPAREN, token.SEMI_COLON},
+		{"let = 5;", ErrUnexpectedToken, `expected next token to be IDENT, got = instead`, 1, 5, 4, token.IDENT, token.ASSIGN},
+		{"let x 5;", ErrUnexpectedToken, `expected next token to be =, got INTEGER "5" instead`, 1, 7, 6, token.ASSIGN, token.INTEGER},
+		{"\nfoo(1, 2;", ErrUnexpectedToken, "expected next token to be ), got ; instead", 2, 9, 9, token.RPAREN, token.SEMI_COLON},
+		{"[1, 2", ErrUnexpectedToken, "expected next token to be ], got EOF instead", 1, 6, 5, token.RBRACKET, token.EOF},
+		{"a[1;", ErrUnexpectedToken, "expected next token to be ], got ; instead", 1, 4, 3, token.RBRACKET, token.SEMI_COLON},
+		{`{"a" 1}`, ErrUnexpectedToken, `expected next token to be :, got INTEGER "1" instead`, 1, 6, 5, token.COLON, token.INTEGER},
+		{`{"a": 1 "b": 2}`, ErrUnexpectedToken, `expected next token to be , or }, got STRING "b" instead`, 1, 9, 8, token.RBRACE, token.STRING},
+		{"{1: 2", ErrUnexpectedToken, "expected next token to be , or }, got EOF instead", 1, 6, 5, token.RBRACE, token.EOF},
+		{"1 + )", ErrNoPrefixParseFn, "no prefix parse function for ) found", 1, 5, 4, "", token.RPAREN},
+		{"99999999999999999999", ErrIntegerOverflow, "integer 99999999999999999999 overflows int64, the largest integer is 9223372036854775807", 1, 1, 0, "", token.INTEGER},
+		{"x + 0x1_0000_0000_0000_0000", ErrIntegerOverflow, "integer 0x1_0000_0000_0000_0000 overflows int64, the largest integer is 9223372036854775807", 1, 5, 4, "", token.INTEGER},
+		{"let x = 0x;", lexer.ErrMalformedNumber, `malformed number "0x", hexadecimal literal has no digits`, 1, 9, 8, "", token.ILLEGAL},
+		{"1e999", ErrFloatOverflow, "float 1e999 overflows float64, the largest float is 1.7976931348623157e+308", 1, 1, 0, "", token.FLOAT},
+		{"x * 1e400", ErrFloatOverflow, "float 1e400 overflows float64, the largest float is 1.7976931348623157e+308", 1, 5, 4, "", token.FLOAT},
+		{"1.8e308", ErrFloatOverflow, "float 1.8e308 overflows float64, the largest float is 1.7976931348623157e+308", 1, 1, 0, "", token.FLOAT},
+		{"if (x) { x", ErrUnclosedBlock, "expected block to be closed with }, got EOF instead", 1, 11, 10, token.RBRACE, token.EOF},
+		{`"abc`, lexer.ErrUnterminatedString, "unterminated string", 1, 1, 0, "", token.ILLEGAL},
+		{"x;\n/* abc", lexer.ErrUnterminatedComment, "unterminated block comment", 2, 1, 3, "", token.ILLEGAL},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+
+		err := errors[0]
+		if err.Code != tt.code || err.Message != tt.message {
+			t.Errorf("%q: expected %s %q, got %s %q", tt.input, tt.code, tt.message, err.Code, err.Message)
+		}
+
+		if err.Line != tt.line || err.Column != tt.column || err.Offset != tt.offset {
+			t.Errorf("%q: expected position %d:%d (offset %d), got %d:%d (offset %d)", tt.input,
+				tt.line, tt.column, tt.offset, err.Line, err.Column, err.Offset)
+		}
+
+		if err.Expected != tt.expected || err.Actual.Type != tt.actual {
+			t.Errorf("%q: expected %q/%q tokens, got %q/%q", tt.input, tt.expected, tt.actual, err.Expected, err.Actual.Type)
+		}
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x = (1 + 2;",
+			"error[P001] 1:15: expected next token to be ), got ; instead\n" +
+				"  1 | let x = (1 + 2;\n" +
+				"    |               ^\n",
+		},
+		{
+			"let a = 1;\n\tlet b = (a;\nlet c = 3;",
+			"error[P001] 2:12: expected next token to be ), got ; instead\n" +
+				"  2 | \tlet b = (a;\n" +
+				"    | \t          ^\n",
+		},
+		{
+			"let é = (\"ü\";",
+			"error[P001] 1:13: expected next token to be ), got ; instead\n" +
+				"  1 | let é = (\"ü\";\n" +
+				"    |             ^\n",
+		},
+		{
+			"let 世界 = (\"ｘ\";",
+			"error[P001] 1:14: expected next token to be ), got ; instead\n" +
+				"  1 | let 世界 = (\"ｘ\";\n" +
+				"    |                 ^\n",
+		},
+		{
+			"\t\"e\u0301\" + (1 \t2",
+			"error[P001] 1:13: expected next token to be ), got INTEGER \"2\" instead\n" +
+				"  1 | \t\"e\u0301\" + (1 \t2\n" +
+				"    | \t         \t^\n",
+		},
+		{
+			"if (x) { x",
+			"error[P004] 1:11: expected block to be closed with }, got EOF instead\n" +
+				"  1 | if (x) { x\n" +
+				"    |           ^\n",
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Fatalf("%q: expected an error", tt.input)
+		}
+
+		actual := RenderError(tt.input, p.Errors()[0])
+		if actual != tt.expected {
+			t.Errorf("%q: expected\n%s\ngot\n%s", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements string
+	}{
+		{
+			"let x = ; let y = 2; y",
+			[]string{"1:9: no prefix parse function for ; found"},
+			"let y = 2;y",
+		},
+		{
+			"let = 1\nlet a = (1 + ;\nlet b = 3\nreturn )",
+			[]string{
+				"1:5: expected next token to be IDENT, got = instead",
+				"2:14: no prefix parse function for ; found",
+				"4:8: no prefix parse function for ) found",
+			},
+			"let b = 3;",
+		},
+		{
+			"let f = fn() { let = 1; 2 }; f()",
+			[]string{"1:20: expected next token to be IDENT, got = instead"},
+			"f()",
+		},
+		{
+			"if (x) { let 1; y } else { z }",
+			[]string{`1:14: expected next token to be IDENT, got INTEGER "1" instead`},
+			"",
+		},
+		{
+			"} let a = 1",
+			[]string{"1:1: no prefix parse function for } found"},
+			"let a = 1;",
+		},
+		{
+			"let s = \"abc\nlet t = 1",
+			[]string{"1:9: unterminated string"},
+			"",
+		},
+		{
+			"\"abc",
+			[]string{"1:1: unterminated string"},
+			"",
+		},
+		{
+			"let a = 1\n\"abc",
+			[]string{"2:1: unterminated string"},
+			"let a = 1;",
+		},
+		{
+			"x +",
+			[]string{"1:4: no prefix parse function for EOF found"},
+			"",
+		},
+		{
+			"let f = fn(x, ) {}",
+			[]string{"1:15: expected next token to be IDENT, got ) instead"},
+			"",
+		},
+		{
+			"let f = fn(x, ) { let y = 1; y }; f",
+			[]string{"1:15: expected next token to be IDENT, got ) instead"},
+			"f",
+		},
+		{
+			"fn() { let f = fn(x, ) { 1 }; 2 }; x",
+			[]string{"1:22: expected next token to be IDENT, got ) instead"},
+			"x",
+		},
+		{
+			"x;\xff",
+			[]string{"1:3: invalid UTF-8 encoding"},
+			"x",
+		},
+		{
+			"x; 1 + \xff; y",
+			[]string{"1:8: invalid UTF-8 encoding"},
+			"xy",
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		if program == nil {
+			t.Fatalf("%q: ParseProgram() returned nil", tt.input)
+		}
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("%q: expected %d errors, got %d: %q", tt.input, len(tt.expectedErrors), len(errors), errors)
+			continue
+		}
+
+		for i, msg := range tt.expectedErrors {
+			if errors[i].Error() != msg {
+				t.Errorf("%q: expected error %q, got %q", tt.input, msg, errors[i].Error())
+			}
+		}
+
+		if program.String() != tt.expectedStatements {
+			t.Errorf("%q: expected statements %q, got %q", tt.input, tt.expectedStatements, program.String())
+		}
+	}
+}
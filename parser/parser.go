@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 	"regexp"
 	"runtime"
@@ -16,12 +17,15 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
 	LESSGREATER // < or >
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
 	CALL        // myFunction(X)
+	INDEX       // array[index]
 )
 
 type (
@@ -35,9 +39,25 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 
-	errors []string
+	errors []*ParseError
 
-	pos int
+	// number of lexer errors already seen, and those found lexing peekToken
+	// (which are reported once it becomes curToken)
+	lexerErrors int
+	peekErrors  []*ParseError
+
+	// len(errors) before those found lexing curToken were added
+	curErrors int
+
+	// the comments skipped over, when the lexer returns them
+	comments []*ast.Comment
+
+	// how many blocks deep the statement being parsed is
+	blocks int
+
+	// set after an error, until the parser has skipped to the next statement,
+	// so that one mistake isn't reported many times over
+	recovering bool
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -50,14 +70,24 @@ func (p *Parser) Summary() string {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []*ParseError{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INTEGER, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TRUE, p.parseBoolean)
+	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -68,6 +98,12 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQUAL, p.parseInfixExpression)
 	p.registerInfix(token.LESS_THAN, p.parseInfixExpression)
 	p.registerInfix(token.GREATER_THAN, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
@@ -88,76 +124,98 @@ var precedences = map[token.TokenType]int{
 	token.NOT_EQUAL:    EQUALS,
 	token.LESS_THAN:    LESSGREATER,
 	token.GREATER_THAN: LESSGREATER,
+	token.LT_EQ:        LESSGREATER,
+	token.GT_EQ:        LESSGREATER,
+	token.AND:          AND,
+	token.OR:           OR,
 	token.PLUS:         SUM,
 	token.MINUS:        SUM,
 	token.DIVIDE:       PRODUCT,
 	token.MULTIPLY:     PRODUCT,
+	token.LPAREN:       CALL,
+	token.LBRACKET:     INDEX,
 }
 
-func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
+// Precedence is how tightly an infix operator binds, LOWEST for tokens which
+// aren't infix operators
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
 		return p
 	}
 
 	return LOWEST
 }
 
-func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
-		return p
-	}
+func (p *Parser) peekPrecedence() int {
+	return Precedence(p.peekToken.Type)
+}
 
-	return LOWEST
+func (p *Parser) curPrecedence() int {
+	return Precedence(p.curToken.Type)
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []*ParseError {
 	return p.errors
 }
 
+func (p *Parser) error(code string, actual token.Token, format string, a ...interface{}) *ParseError {
+	err := newParseError(code, p.l.Base(), actual, format, a...)
+	if !p.recovering {
+		p.errors = append(p.errors, err)
+		p.recovering = true
+	}
+	return err
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Pretty())
-	p.errors = append(p.errors, msg)
+	err := p.error(ErrUnexpectedToken, p.peekToken, "expected next token to be %s, got %s instead", t, describe(p.peekToken))
+	err.Expected = t
 }
 
-func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+func (p *Parser) noPrefixParseFnError(t token.Token) {
+	p.error(ErrNoPrefixParseFn, t, "no prefix parse function for %s found", describe(t))
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
+	p.curErrors = len(p.errors)
+	p.errors = append(p.errors, p.peekErrors...)
+
 	p.peekToken = p.l.NextToken()
-	p.pos++
+	for p.peekToken.Type == token.COMMENT {
+		p.comments = append(p.comments, &ast.Comment{Token: p.peekToken})
+		p.peekToken = p.l.NextToken()
+	}
+
+	// the lexer reads a character ahead, so it may already have reported
+	// an error in the token after peekToken, which waits for that token
+	p.peekErrors = nil
+	lexerErrors := p.l.Errors()
+	for ; p.lexerErrors < len(lexerErrors); p.lexerErrors++ {
+		err := lexerErrors[p.lexerErrors]
+		if p.peekToken.Type != token.EOF && p.l.Base()+err.Offset >= p.peekToken.End {
+			break
+		}
+		p.peekErrors = append(p.peekErrors, fromLexerError(err, p.peekToken))
+	}
 }
 
+// ParseProgram parses every statement it can. A statement with errors is
+// left out of the program, and parsing carries on from the next one.
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 
 	program.Statements = []ast.Statement{}
 
-	currentPos := 0
 	for !p.curTokenIs(token.EOF) {
-
 		stmt := p.parseStatement()
-
-		//		fmt.Printf("\nParsed statement\n%#v\n\n", stmt)
-
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 
-		//		fmt.Printf("p.peekToken.Type ? '%#v'. current pos %d vs p.pos %d\n", p.peekToken, currentPos, p.pos)
-		if currentPos == p.pos {
-			msg := fmt.Sprintf("Failed to advance tokens. Parsing must have failed! Current Token %#v, Peek Token %#v\n", p.curToken, p.peekToken)
-			p.errors = append(p.errors, msg)
-			return nil
-		}
-
-		currentPos = p.pos
-
-		// should this be here or after currentPos assignment
 		p.nextToken()
 	}
+	program.Comments = p.comments
 
 	return program
 }
@@ -195,15 +253,65 @@ func (p *Parser) parseStatement() ast.Statement {
 	indent++
 	defer func() { indent-- }()
 
+	// include any errors from lexing the first token of the statement
+	errors := p.curErrors
+
+	var stmt ast.Statement
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		stmt = p.parseLetStatement()
 	case token.RETURN:
-		return p.parseReturnStatement()
+		stmt = p.parseReturnStatement()
 	default:
-		return p.parseExpressionStatement()
+		stmt = p.parseExpressionStatement()
+	}
+
+	if len(p.errors) > errors {
+		p.synchronize()
+		return nil
 	}
 
+	// an illegal token has no expression, though its error is the lexer's
+	if s, ok := stmt.(*ast.ExpressionStatement); ok && s.Expression == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// synchronize skips the rest of a statement which failed to parse, so that
+// parsing can carry on with the next. It leaves curToken on the ; ending the
+// statement, or before the next let, return or EOF, or the } closing the
+// block the statement is in. Any braces within the statement are skipped
+// over along with what's between them.
+func (p *Parser) synchronize() {
+	defer func() { p.recovering = false }()
+
+	depth := 0 // of the braces skipped over
+	for !p.curTokenIs(token.EOF) {
+		if depth == 0 {
+			if p.curTokenIs(token.SEMI_COLON) {
+				return
+			}
+
+			switch p.peekToken.Type {
+			case token.LET, token.RETURN, token.EOF:
+				return
+			case token.RBRACE:
+				if p.blocks > 0 {
+					return
+				}
+			}
+		}
+
+		p.nextToken()
+		switch {
+		case p.curTokenIs(token.LBRACE):
+			depth++
+		case p.curTokenIs(token.RBRACE) && depth > 0:
+			depth--
+		}
+	}
 }
 
 // let <ident> = <expr>;
@@ -220,7 +328,14 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		return nil
 	}
 
-	p.eatUntilSemiColon()
+	p.nextToken()
+
+	s.Value = p.parseExpression(LOWEST)
+
+	// semi-colon is optional
+	if p.peekTokenIs(token.SEMI_COLON) {
+		p.nextToken()
+	}
 
 	return s
 }
@@ -229,7 +344,14 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	s := &ast.ReturnStatement{Token: p.curToken}
 
-	p.eatUntilSemiColon()
+	p.nextToken()
+
+	s.Value = p.parseExpression(LOWEST)
+
+	// semi-colon is optional
+	if p.peekTokenIs(token.SEMI_COLON) {
+		p.nextToken()
+	}
 
 	return s
 }
@@ -247,12 +369,9 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 	//	fmt.Printf("Parsed expression '%#v'.\nParser state: '%#v'\n", s.Expression, p)
 
+	// semi-colon is optional
 	if p.peekTokenIs(token.SEMI_COLON) {
-		// make semi-colon next token
 		p.nextToken()
-
-		// FIXME:
-		p.eatUntilSemiColon()
 	}
 
 	return s
@@ -277,7 +396,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	}
 
 	if prefix == nil {
-		p.noPrefixParseFnError(p.curToken.Type)
+		p.noPrefixParseFnError(p.curToken)
 		return nil
 	}
 
@@ -318,8 +437,11 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	// if base == 0, the prefix of the string determines the base (i.e. 0x etc)
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		if err.(*strconv.NumError).Err == strconv.ErrRange {
+			p.error(ErrIntegerOverflow, p.curToken, "integer %s overflows int64, the largest integer is %d", p.curToken.Literal, int64(math.MaxInt64))
+		} else {
+			p.error(ErrInvalidInteger, p.curToken, "could not parse %q as integer", p.curToken.Literal)
+		}
 		return nil
 	}
 
@@ -328,6 +450,29 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return e
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		if err.(*strconv.NumError).Err == strconv.ErrRange {
+			p.error(ErrFloatOverflow, p.curToken, "float %s overflows float64, the largest float is %g", p.curToken.Literal, math.MaxFloat64)
+		} else {
+			p.error(ErrInvalidFloat, p.curToken, "could not parse %q as float", p.curToken.Literal)
+		}
+		return nil
+	}
+
+	return &ast.FloatLiteral{Token: p.curToken, Value: value}
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// the lexer has already reported why the token is illegal
+func (p *Parser) parseIllegal() ast.Expression {
+	return nil
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expr := &ast.PrefixExpression{
 		Token:    p.curToken,
@@ -371,9 +516,231 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expr
 }
 
-// FIXME: implement values
-func (p *Parser) eatUntilSemiColon() {
-	for !p.curTokenIs(token.SEMI_COLON) {
+func (p *Parser) parseBoolean() ast.Expression {
+	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+}
+
+// ( <expr> )
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	expr := &ast.GroupedExpression{Token: p.curToken}
+
+	p.nextToken()
+
+	expr.Expression = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	expr.Rparen = token.Pos(p.curToken.Position)
+
+	return expr
+}
+
+// if ( <expr> ) { <stmts> } [else { <stmts> }]
+func (p *Parser) parseIfExpression() ast.Expression {
+	expr := &ast.IfExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expr.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expr.Consequence = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expr.Alternative = p.parseBlockStatement()
 	}
+
+	return expr
+}
+
+// { <stmts> }, leaves curToken on the closing brace
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+
+	p.blocks++
+	defer func() { p.blocks-- }()
+
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+
+		p.nextToken()
+	}
+
+	block.Rbrace = token.Pos(p.curToken.Position)
+
+	if !p.curTokenIs(token.RBRACE) {
+		err := p.error(ErrUnclosedBlock, p.curToken, "expected block to be closed with %s, got %s instead", token.RBRACE, describe(p.curToken))
+		err.Expected = token.RBRACE
+	}
+
+	return block
+}
+
+// fn ( <ident>, ... ) { <stmts> }
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	fl := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	fl.Parameters = p.parseFunctionParameters()
+	if fl.Parameters == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	fl.Body = p.parseBlockStatement()
+
+	return fl
+}
+
+func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return identifiers
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return identifiers
+}
+
+// <expr> ( <expr>, ... )
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	expr := &ast.CallExpression{Token: p.curToken, Function: function}
+	expr.Arguments = p.parseExpressionList(token.RPAREN)
+	expr.Rparen = token.Pos(p.curToken.Position)
+	return expr
+}
+
+// [ <expr>, ... ]
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Rbracket = token.Pos(p.curToken.Position)
+	return array
+}
+
+// { <expr> : <expr>, ... }
+//
+// Blocks are only parsed where a statement expects one (after if, else and
+// fn), so a brace which starts an expression is always a hash.
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken, Pairs: []ast.HashPair{}}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		} else if !p.peekTokenIs(token.RBRACE) {
+			// either would do, but it's } which the hash is missing
+			err := p.error(ErrUnexpectedToken, p.peekToken, "expected next token to be %s or %s, got %s instead", token.COMMA, token.RBRACE, describe(p.peekToken))
+			err.Expected = token.RBRACE
+			return nil
+		}
+	}
+
+	p.nextToken()
+	hash.Rbrace = token.Pos(p.curToken.Position)
+
+	return hash
+}
+
+// <expr> [ <expr> ]
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	expr := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	expr.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	expr.Rbracket = token.Pos(p.curToken.Position)
+
+	return expr
+}
+
+// parseExpressionList parses comma separated expressions up to the end
+// token, leaving curToken on it
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	list = append(list, p.parseExpression(LOWEST))
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
 }
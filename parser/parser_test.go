@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/sscaling/monkey/ast"
@@ -9,46 +10,39 @@ import (
 )
 
 func TestLetStatements(t *testing.T) {
-	input := `
-		let x = 5;
-		let y = 10;
-		let foobar = 838383;
-	`
-	/*	input := `
-		let x  5;
-		let  = 10;
-		let  838383;
-		`
-	*/
-
-	l := lexer.New(input)
-	p := New(l)
-
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
-	if program == nil {
-		t.Fatalf("ParseProgram() returned nil")
-	}
-
-	if len(program.Statements) != 3 {
-		t.Fatalf("program.Statements does not contain 3 statements. got '%d'", len(program.Statements))
-	}
-
 	tests := []struct {
+		input              string
 		expectedIdentifier string
+		expectedValue      interface{}
 	}{
-		{"x"},
-		{"y"},
-		{"foobar"},
+		{"let x = 5;", "x", 5},
+		{"let y = 10", "y", 10},
+		{"let foobar = y;", "foobar", "y"},
 	}
 
-	for i, tt := range tests {
-		fmt.Printf("Testing '%s'\n", tt.expectedIdentifier)
-		stmt := program.Statements[i]
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program == nil {
+			t.Fatalf("ParseProgram() returned nil")
+		}
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got '%d'", len(program.Statements))
+		}
 
+		stmt := program.Statements[0]
 		if !testLetStatement(t, stmt, tt.expectedIdentifier) {
 			return
 		}
+
+		value := stmt.(*ast.LetStatement).Value
+		if !testLiteralExpression(t, value, tt.expectedValue) {
+			return
+		}
 	}
 }
 
@@ -80,33 +74,38 @@ func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 }
 
 func TestReturnStatements(t *testing.T) {
-	input := `
-		return 5;
-		return 10;
-		return 993322;
-	`
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{"return 5;", 5},
+		{"return 10", 10},
+		{"return foobar;", "foobar"},
+	}
 
-	l := lexer.New(input)
-	p := New(l)
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
 
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
 
-	if len(program.Statements) != 3 {
-		t.Fatalf("program.Statements does not contain 3 statements. got = %d", len(program.Statements))
-	}
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got = %d", len(program.Statements))
+		}
 
-	for _, stmt := range program.Statements {
-		returnStmt, ok := stmt.(*ast.ReturnStatement)
+		returnStmt, ok := program.Statements[0].(*ast.ReturnStatement)
 		if !ok {
-			t.Errorf("stmt not *ast.returnStatment. got = %T", stmt)
-			// is this needed?
-			continue
+			t.Fatalf("stmt not *ast.returnStatment. got = %T", program.Statements[0])
 		}
 
 		if returnStmt.TokenLiteral() != "return" {
 			t.Errorf("returnStmt.TokenLiteral not 'return', got %q", returnStmt.TokenLiteral())
 		}
+
+		if !testLiteralExpression(t, returnStmt.Value, tt.expectedValue) {
+			return
+		}
 	}
 }
 
@@ -286,6 +285,26 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"5 > 4 == 3 < 4", "((5 > 4) == (3 < 4))"},
 		{"5 < 4 != 3 > 4", "((5 < 4) != (3 > 4))"},
 		{"3 + 4 * 5 == 3 * 1 + 4 * 5", "((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))"},
+		{"let x = a + b * c; return -x", "let x = (a + (b * c));return(-x);"},
+		{"true", "true"},
+		{"3 > 5 == false", "((3 > 5) == false)"},
+		{"1 + (2 + 3) + 4", "((1 + (2 + 3)) + 4)"},
+		{"(5 + 5) * 2", "((5 + 5) * 2)"},
+		{"2 / (5 + 5)", "(2 / (5 + 5))"},
+		{"-(5 + 5)", "(-(5 + 5))"},
+		{"!(true == true)", "(!(true == true))"},
+		{"a + add(b * c) + d", "((a + add((b * c))) + d)"},
+		{"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))", "add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))"},
+		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
+		{"a <= b == c >= d", "((a <= b) == (c >= d))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c && d", "((a && b) || (c && d))"},
+		{"a == b && c != d || !e", "(((a == b) && (c != d)) || (!e))"},
+		{"a < b + 1 && f(c)", "((a < (b + 1)) && f(c))"},
+		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"-a[0]", "(-(a[0]))"},
+		{"f(x)[0](y)", "(f(x)[0])(y)"},
 	}
 
 	for _, tt := range tests {
@@ -303,6 +322,245 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 	}
 }
 
+func TestBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true;", true},
+		{"false;", false},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		testBooleanLiteral(t, stmt.Expression, tt.expected)
+	}
+}
+
+func TestIfExpression(t *testing.T) {
+	program := parseProgram(t, "if (x < y) { x }")
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Consequence.Statements) != 1 {
+		t.Fatalf("consequence is not 1 statement. got=%d", len(exp.Consequence.Statements))
+	}
+
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T", exp.Consequence.Statements[0])
+	}
+
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+
+	if exp.Alternative != nil {
+		t.Errorf("exp.Alternative was not nil. got=%+v", exp.Alternative)
+	}
+}
+
+func TestIfElseExpression(t *testing.T) {
+	program := parseProgram(t, "if (x < y) { x } else { y; }")
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if exp.Alternative == nil || len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("alternative is not 1 statement. got=%+v", exp.Alternative)
+	}
+
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T", exp.Alternative.Statements[0])
+	}
+
+	testIdentifier(t, alternative.Expression, "y")
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	program := parseProgram(t, "fn(x, y) { x + y; }")
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d", len(function.Parameters))
+	}
+
+	testLiteralExpression(t, function.Parameters[0], "x")
+	testLiteralExpression(t, function.Parameters[1], "y")
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statement. got=%d", len(function.Body.Statements))
+	}
+
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T", function.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{"fn() {};", []string{}},
+		{"fn(x) {};", []string{"x"}},
+		{"fn(x, y, z) {};", []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d", len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	program := parseProgram(t, "add(1, 2 * 3, 4 + 5);")
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Function, "add") {
+		return
+	}
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+}
+
+func TestArrayLiteralParsing(t *testing.T) {
+	program := parseProgram(t, "[1, 2 * 2, 3 + 3]")
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("wrong length of elements. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+
+	program = parseProgram(t, "[]")
+	array = program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ArrayLiteral)
+	if len(array.Elements) != 0 {
+		t.Errorf("expected no elements, got %d", len(array.Elements))
+	}
+}
+
+func TestIndexExpressionParsing(t *testing.T) {
+	program := parseProgram(t, "myArray[1 + 1]")
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	index, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, index.Left, "myArray") {
+		return
+	}
+
+	testInfixExpression(t, index.Index, 1, "+", 1)
+}
+
+func TestHashLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{}", "{}"},
+		{`{"one": 1, "two": 2, "three": 3}`, `{one: 1, two: 2, three: 3}`},
+		{`{"one": 0 + 1, two: 10 - 8, 3: 15 / 5,}`, `{one: (0 + 1), two: (10 - 8), 3: (15 / 5)}`},
+		{"{true: {}, false: [1]}[true]", "({true: {}, false: [1]}[true])"},
+		{"if ({1: 2}[1]) { {} }", "if({1: 2}[1]) {}"},
+		{"fn() { {1: 2} }", "fn() {1: 2}"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+
+	program := parseProgram(t, `{"a": 1, 2: b}`)
+	hash, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("expression is not ast.HashLiteral. got=%T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+	if len(hash.Pairs) != 2 {
+		t.Fatalf("hash has wrong number of pairs. got=%d", len(hash.Pairs))
+	}
+	testIntegerLiteral(t, hash.Pairs[0].Value, 1)
+	testIntegerLiteral(t, hash.Pairs[1].Key, 2)
+	testIdentifier(t, hash.Pairs[1].Value, "b")
+}
+
+func TestUnclosedBlockStatement(t *testing.T) {
+	p := New(lexer.New("if (x) { x"))
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected an error for an unclosed block")
+	}
+}
+
 /*
 func TestTest(t *testing.T) {
 	s := strings.Join(make([]string, 8), " ")
@@ -311,6 +569,21 @@ func TestTest(t *testing.T) {
 }
 */
 
+// parseProgram parses a single statement program, failing on any parser error
+func parseProgram(t *testing.T, input string) *ast.Program {
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got = %d", len(program.Statements))
+	}
+
+	return program
+}
+
 func testIntegerLiteral(t *testing.T, exp ast.Expression, expected int64) bool {
 	literal, ok := exp.(*ast.IntegerLiteral)
 	if !ok {
@@ -331,6 +604,85 @@ func testIntegerLiteral(t *testing.T, exp ast.Expression, expected int64) bool {
 	return true
 }
 
+func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
+	ident, ok := exp.(*ast.Identifier)
+	if !ok {
+		t.Errorf("exp not *ast.Identifier. got=%T", exp)
+		return false
+	}
+
+	if ident.Value != value {
+		t.Errorf("ident.Value not %s, got=%s", value, ident.Value)
+		return false
+	}
+
+	if ident.TokenLiteral() != value {
+		t.Errorf("ident.TokenLiteral not %s, got=%s", value, ident.TokenLiteral())
+		return false
+	}
+
+	return true
+}
+
+func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
+	b, ok := exp.(*ast.Boolean)
+	if !ok {
+		t.Errorf("exp not *ast.Boolean. got=%T", exp)
+		return false
+	}
+
+	if b.Value != value {
+		t.Errorf("b.Value not %t, got=%t", value, b.Value)
+		return false
+	}
+
+	if b.TokenLiteral() != fmt.Sprintf("%t", value) {
+		t.Errorf("b.TokenLiteral not %t, got=%s", value, b.TokenLiteral())
+		return false
+	}
+
+	return true
+}
+
+func testInfixExpression(t *testing.T, exp ast.Expression, left interface{}, operator string, right interface{}) bool {
+	opExp, ok := exp.(*ast.InfixExpression)
+	if !ok {
+		t.Errorf("exp is not ast.InfixExpression. got=%T(%s)", exp, exp)
+		return false
+	}
+
+	if !testLiteralExpression(t, opExp.Left, left) {
+		return false
+	}
+
+	if opExp.Operator != operator {
+		t.Errorf("exp.Operator is not '%s'. got=%q", operator, opExp.Operator)
+		return false
+	}
+
+	if !testLiteralExpression(t, opExp.Right, right) {
+		return false
+	}
+
+	return true
+}
+
+func testLiteralExpression(t *testing.T, exp ast.Expression, expected interface{}) bool {
+	switch v := expected.(type) {
+	case int:
+		return testIntegerLiteral(t, exp, int64(v))
+	case int64:
+		return testIntegerLiteral(t, exp, v)
+	case string:
+		return testIdentifier(t, exp, v)
+	case bool:
+		return testBooleanLiteral(t, exp, v)
+	}
+
+	t.Errorf("type of exp not handled. got=%T", exp)
+	return false
+}
+
 func checkParserErrors(t *testing.T, p *Parser) {
 	errors := p.Errors()
 	if len(errors) == 0 {
@@ -340,9 +692,139 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	p.l.Debug()
 	t.Errorf("parser has %d errors", len(errors))
 
-	for _, msg := range errors {
-		t.Errorf("parser error: %q", msg)
+	for _, err := range errors {
+		t.Errorf("parser error: %q", err.Error())
 	}
 
 	t.FailNow()
 }
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9", 1e-9},
+		{"2.5E3", 2500},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("%q: expected *ast.FloatLiteral, got %T", tt.input, stmt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("%q: expected %g, got %g", tt.input, tt.expected, literal.Value)
+		}
+
+		if literal.String() != strings.TrimSuffix(tt.input, ";") {
+			t.Errorf("%q: expected the literal as written, got %q", tt.input, literal.String())
+		}
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	program := parseProgram(t, `"hello \"world\"";`)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != `hello "world"` {
+		t.Errorf("literal.Value not %q. got=%q", `hello "world"`, literal.Value)
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let s = \"abc", []string{"1:9: unterminated string"}},
+		{"let x = 1 ^ 2;", []string{"1:11: illegal character '^'"}},
+		{"let x = ^;", []string{"1:9: illegal character '^'"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) < len(tt.expected) {
+			t.Fatalf("%q: expected errors %q, got %q", tt.input, tt.expected, errors)
+		}
+
+		for i, msg := range tt.expected {
+			if errors[i].Error() != msg {
+				t.Errorf("%q: expected error %q, got %q", tt.input, msg, errors[i].Error())
+			}
+		}
+	}
+}
+
+func TestNodeSpans(t *testing.T) {
+	input := `let add = fn(a, b) { return a + b; };
+if (add(1, -2) > 0) { "yes" } else { false };
+(1 + 2) * x;
+[a, b[0]];
+{"k": v}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	source := func(n ast.Node) string {
+		return input[n.Pos():n.End()]
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	ret := fn.Body.Statements[0].(*ast.ReturnStatement)
+	ifExp := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	cond := ifExp.Condition.(*ast.InfixExpression)
+	call := cond.Left.(*ast.CallExpression)
+	product := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	array := program.Statements[3].(*ast.ExpressionStatement).Expression.(*ast.ArrayLiteral)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{let, "let add = fn(a, b) { return a + b; }"},
+		{let.Name, "add"},
+		{fn, "fn(a, b) { return a + b; }"},
+		{fn.Parameters[1], "b"},
+		{fn.Body, "{ return a + b; }"},
+		{ret, "return a + b"},
+		{ifExp, `if (add(1, -2) > 0) { "yes" } else { false }`},
+		{cond, "add(1, -2) > 0"},
+		{call, "add(1, -2)"},
+		{call.Arguments[1], "-2"},
+		{ifExp.Consequence.Statements[0], `"yes"`},
+		{ifExp.Alternative, "{ false }"},
+		{product, "(1 + 2) * x"},
+		{product.Left, "(1 + 2)"},
+		{array, "[a, b[0]]"},
+		{array.Elements[1], "b[0]"},
+		{program.Statements[4], `{"k": v}`},
+		{program, input},
+	}
+
+	for _, tt := range tests {
+		if actual := source(tt.node); actual != tt.expected {
+			t.Errorf("%T: expected span %q, got %q", tt.node, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,454 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// HISTORY_FILE is where the line editor keeps its history, in the home
+// directory
+const HISTORY_FILE = ".monkey_history"
+
+// the number of lines of history which are kept
+const maxHistory = 1000
+
+// errInterrupted is returned by readLine when Ctrl-C abandons the input
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads the input a line at a time, showing the prompt first
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// newLineReader returns the line editor when in is a terminal, otherwise
+// (i.e. when the input is piped) lines are read as they are. names gives the
+// words which tab completes.
+func newLineReader(in io.Reader, out io.Writer, names func() []string) lineReader {
+	if f, ok := in.(*os.File); ok && isTerminal(int(f.Fd())) {
+		e := newEditor(f, out, names)
+		e.raw = func() (func(), error) { return makeRaw(int(f.Fd())) }
+
+		if home, err := os.UserHomeDir(); err == nil {
+			e.loadHistory(filepath.Join(home, HISTORY_FILE))
+		}
+		return e
+	}
+
+	return &scanner{s: bufio.NewScanner(in), out: out}
+}
+
+type scanner struct {
+	s   *bufio.Scanner
+	out io.Writer
+}
+
+func (s *scanner) readLine(prompt string) (string, error) {
+	fmt.Fprint(s.out, prompt)
+
+	if !s.s.Scan() {
+		if err := s.s.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+
+	return s.s.Text(), nil
+}
+
+// editor reads lines from a terminal with emacs style key bindings, history
+// and tab completion. The line is redrawn after each key, which assumes it
+// fits on one row of the terminal.
+type editor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// raw puts the terminal in raw mode while a line is read, returning a
+	// function which restores it. It's nil when there's no terminal.
+	raw func() (func(), error)
+
+	names func() []string
+
+	history      []string
+	historyFile  string // where each line is appended, if set
+	historyIndex int    // of the line being shown, len(history) for a new one
+	saved        []rune // the new line, while history is being shown
+
+	prompt string
+	line   []rune
+	pos    int    // of the cursor in line
+	killed []rune // by the last Ctrl-K, Ctrl-U or Ctrl-W, for Ctrl-Y
+}
+
+func newEditor(in io.Reader, out io.Writer, names func() []string) *editor {
+	return &editor{in: bufio.NewReader(in), out: out, names: names}
+}
+
+func ctrl(c rune) rune {
+	return c & 0x1f
+}
+
+func (e *editor) readLine(prompt string) (string, error) {
+	if e.raw != nil {
+		restore, err := e.raw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	e.prompt, e.line, e.pos = prompt, nil, 0
+	e.historyIndex, e.saved = len(e.history), nil
+	e.refresh()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\r\n")
+			line := string(e.line)
+			e.addHistory(line)
+			return line, nil
+		case ctrl('C'):
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case ctrl('D'):
+			if len(e.line) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.delete(e.pos, e.pos+1)
+		case ctrl('A'):
+			e.pos = 0
+		case ctrl('E'):
+			e.pos = len(e.line)
+		case ctrl('B'):
+			if e.pos > 0 {
+				e.pos--
+			}
+		case ctrl('F'):
+			if e.pos < len(e.line) {
+				e.pos++
+			}
+		case ctrl('H'), 127:
+			if e.pos > 0 {
+				e.delete(e.pos-1, e.pos)
+			}
+		case ctrl('K'):
+			e.kill(e.pos, len(e.line))
+		case ctrl('U'):
+			e.kill(0, e.pos)
+		case ctrl('W'):
+			e.kill(e.wordStart(), e.pos)
+		case ctrl('Y'):
+			e.insert(e.killed...)
+		case ctrl('P'):
+			e.historyPrev()
+		case ctrl('N'):
+			e.historyNext()
+		case ctrl('L'):
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case '\t':
+			e.complete()
+		case 27:
+			e.escape()
+		default:
+			if unicode.IsPrint(r) {
+				e.insert(r)
+			}
+		}
+
+		e.refresh()
+	}
+}
+
+// escape handles the keys which send an escape sequence: the arrows, home,
+// end and delete, and alt with b, f, d or backspace for words
+func (e *editor) escape() {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return
+	}
+
+	switch r {
+	case 'b':
+		e.pos = e.wordStart()
+		return
+	case 'f':
+		e.pos = e.wordEnd()
+		return
+	case 'd':
+		e.kill(e.pos, e.wordEnd())
+		return
+	case 127:
+		e.kill(e.wordStart(), e.pos)
+		return
+	case '[', 'O':
+	default:
+		return
+	}
+
+	// a control sequence ends with a byte from @ to ~, i.e. "[A" or "[3~"
+	var seq []rune
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return
+		}
+		seq = append(seq, r)
+		if r >= '@' && r <= '~' {
+			break
+		}
+	}
+
+	switch string(seq) {
+	case "A":
+		e.historyPrev()
+	case "B":
+		e.historyNext()
+	case "C":
+		if e.pos < len(e.line) {
+			e.pos++
+		}
+	case "D":
+		if e.pos > 0 {
+			e.pos--
+		}
+	case "H", "1~", "7~":
+		e.pos = 0
+	case "F", "4~", "8~":
+		e.pos = len(e.line)
+	case "3~":
+		e.delete(e.pos, e.pos+1)
+	}
+}
+
+// refresh redraws the line, leaving the cursor at pos
+func (e *editor) refresh() {
+	var b strings.Builder
+
+	b.WriteString("\r")
+	b.WriteString(e.prompt)
+	b.WriteString(string(e.line))
+	b.WriteString("\x1b[K")
+	if n := len(e.line) - e.pos; n > 0 {
+		fmt.Fprintf(&b, "\x1b[%dD", n)
+	}
+
+	io.WriteString(e.out, b.String())
+}
+
+func (e *editor) insert(rs ...rune) {
+	line := make([]rune, 0, len(e.line)+len(rs))
+	line = append(line, e.line[:e.pos]...)
+	line = append(line, rs...)
+	e.line = append(line, e.line[e.pos:]...)
+	e.pos += len(rs)
+}
+
+// delete removes line[from:to], which is cut short at the end of the line
+func (e *editor) delete(from, to int) {
+	if to > len(e.line) {
+		to = len(e.line)
+	}
+	if from >= to {
+		return
+	}
+
+	e.line = append(e.line[:from], e.line[to:]...)
+	e.pos = from
+}
+
+// kill deletes line[from:to], keeping it for Ctrl-Y
+func (e *editor) kill(from, to int) {
+	if from >= to {
+		return
+	}
+
+	e.killed = append([]rune(nil), e.line[from:to]...)
+	e.delete(from, to)
+}
+
+// wordStart is the start of the word before the cursor, skipping any
+// spaces or punctuation between them
+func (e *editor) wordStart() int {
+	i := e.pos
+	for i > 0 && !isWordChar(e.line[i-1]) {
+		i--
+	}
+	for i > 0 && isWordChar(e.line[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordEnd is the end of the word after the cursor
+func (e *editor) wordEnd() int {
+	i := e.pos
+	for i < len(e.line) && !isWordChar(e.line[i]) {
+		i++
+	}
+	for i < len(e.line) && isWordChar(e.line[i]) {
+		i++
+	}
+	return i
+}
+
+func isWordChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (e *editor) historyPrev() {
+	if e.historyIndex == 0 {
+		return
+	}
+	if e.historyIndex == len(e.history) {
+		e.saved = e.line
+	}
+
+	e.historyIndex--
+	e.show([]rune(e.history[e.historyIndex]))
+}
+
+func (e *editor) historyNext() {
+	if e.historyIndex == len(e.history) {
+		return
+	}
+
+	e.historyIndex++
+	if e.historyIndex == len(e.history) {
+		e.show(e.saved)
+	} else {
+		e.show([]rune(e.history[e.historyIndex]))
+	}
+}
+
+// show replaces the line, with the cursor at the end
+func (e *editor) show(line []rune) {
+	e.line = append([]rune(nil), line...)
+	e.pos = len(e.line)
+}
+
+// complete completes the word before the cursor from the names. With more
+// than one match it's completed as far as they agree, and if that adds
+// nothing they are listed.
+func (e *editor) complete() {
+	start := e.pos
+	for start > 0 && isWordChar(e.line[start-1]) {
+		start--
+	}
+
+	prefix := string(e.line[start:e.pos])
+	if prefix == "" {
+		return
+	}
+
+	matches := e.matches(prefix)
+	if len(matches) == 0 {
+		return
+	}
+
+	// in runes, so a name is never cut part way through a character
+	common := []rune(matches[0])
+	for _, m := range matches[1:] {
+		common = commonPrefix(common, []rune(m))
+	}
+
+	if n := len([]rune(prefix)); len(common) > n {
+		e.insert(common[n:]...)
+		return
+	}
+
+	if len(matches) > 1 {
+		io.WriteString(e.out, "\r\n"+strings.Join(matches, "  ")+"\r\n")
+	}
+}
+
+// commonPrefix gives the start of a which is the same as b
+func commonPrefix(a, b []rune) []rune {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return a[:i]
+}
+
+// matches gives the names starting with prefix, sorted and without
+// duplicates
+func (e *editor) matches(prefix string) []string {
+	seen := map[string]bool{}
+	matches := []string{}
+
+	for _, name := range e.names() {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			matches = append(matches, name)
+		}
+	}
+
+	sort.Strings(matches)
+	return matches
+}
+
+// loadHistory reads the history from filename, where later lines will be
+// saved. It's trimmed to the most recent lines if it has grown too long.
+// History is a convenience, so problems with the file are ignored.
+func (e *editor) loadHistory(filename string) {
+	e.historyFile = filename
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		lines = nil
+	}
+
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+		ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	}
+
+	e.history = lines
+}
+
+// addHistory adds a line unless it's blank or the same as the last one
+func (e *editor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+
+	if e.historyFile == "" {
+		return
+	}
+
+	f, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	io.WriteString(f, line+"\n")
+}
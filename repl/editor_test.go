@@ -0,0 +1,175 @@
+package repl
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testNames() []string {
+	return []string{"let", "len", "last", "puts", "push", "len", "counter", "aé1", "aè2", "éa", "éb"}
+}
+
+// readLines reads lines from an editor given keys as input until it ends
+func readLines(e *editor) ([]string, error) {
+	lines := []string{}
+	for {
+		line, err := e.readLine(PROMPT)
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestEditorKeys(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"abc\r", "abc"},
+		{"abc\x02\x02X\r", "aXbc"},                // Ctrl-B
+		{"bc\x01a\x05d\r", "abcd"},                // Ctrl-A, Ctrl-E
+		{"ac\x1b[Db\x1b[Cd\r", "abcd"},            // left, right
+		{"abc\x7f\x7f\r", "a"},                    // backspace
+		{"abc\x01\x04\r", "bc"},                   // Ctrl-D
+		{"abc\x01\x1b[3~\r", "bc"},                // delete
+		{"abcd\x02\x02\x0b\r", "ab"},              // Ctrl-K
+		{"abcd\x02\x02\x15\r", "cd"},              // Ctrl-U
+		{"let x = 1\x17\x17y\r", "let y"},         // Ctrl-W
+		{"ab cd\x17\x01\x19 \r", "cd ab "},        // Ctrl-W, Ctrl-Y
+		{"one two\x1bb\x1bb\x1bfX\r", "oneX two"}, // Alt-B, Alt-F
+		{"one two\x01\x1bd\r", " two"},            // Alt-D
+		{"one two\x1b\x7f\r", "one "},             // Alt-backspace
+		{"bc\x1b[Ha\x1b[Fd\x1bOHx\r", "xabcd"},    // home, end
+		{"héllo\x02\x02\x7f\r", "hélo"},           // runes, not bytes
+		{"a\tb\r", "ab"},                          // nothing to complete
+		{"pu\x1b[1;5D\r", "pu"},                   // unknown sequences are ignored
+		{"\x03abc\r", ""},                         // Ctrl-C is an interrupt, below
+		{"cou\t(1)\r", "counter(1)"},              // one match
+		{"x = pus\t\r", "x = push"},               // from the middle of a line
+		{"l\t\r", "l"},                            // no common prefix
+		{"pu\t\r", "pu"},                          // listed
+		{"le\tn\r", "len"},                        // le is common to len and let
+		{"a\t\r", "a"},                            // aé and aè share a byte, but not a rune
+		{"aé\t\r", "aé1"},                         // one match after a multibyte rune
+		{"é\t\r", "é"},                            // no common prefix after é
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := newEditor(strings.NewReader(tt.keys), &out, testNames)
+
+		line, err := e.readLine(PROMPT)
+		if strings.HasPrefix(tt.keys, "\x03") {
+			if err != errInterrupted {
+				t.Errorf("%q: expected an interrupt, got %q (%v)", tt.keys, line, err)
+			}
+			continue
+		}
+
+		if err != nil || line != tt.expected {
+			t.Errorf("%q: expected %q, got %q (%v)", tt.keys, tt.expected, line, err)
+		}
+	}
+}
+
+func TestEditorCompletionList(t *testing.T) {
+	var out bytes.Buffer
+	e := newEditor(strings.NewReader("pu\t\r"), &out, testNames)
+	e.readLine(PROMPT)
+
+	if !strings.Contains(out.String(), "\r\npush  puts\r\n") {
+		t.Errorf("expected the matches to be listed, got %q", out.String())
+	}
+}
+
+func TestEditorEOF(t *testing.T) {
+	e := newEditor(strings.NewReader("abc\r\x04"), ioutil.Discard, testNames)
+
+	lines, err := readLines(e)
+	if err != io.EOF || !reflect.DeepEqual(lines, []string{"abc"}) {
+		t.Errorf("expected abc then the end, got %q (%v)", lines, err)
+	}
+
+	// the input running out part way through a line also ends it
+	e = newEditor(strings.NewReader("abc"), ioutil.Discard, testNames)
+	if _, err := e.readLine(PROMPT); err != io.EOF {
+		t.Errorf("expected the end, got %v", err)
+	}
+}
+
+func TestEditorHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "editor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, HISTORY_FILE)
+
+	keys := []string{
+		"first\r",
+		"second\r",
+		"second\r",              // not repeated in the history
+		"  \r",                  // blank lines aren't kept
+		"\x1b[A\x1b[A\r",        // up twice gives first
+		"new\x10\x10\x0e\x0e\r", // Ctrl-P and back with Ctrl-N keeps the new line
+		"\x1b[A!\r",             // a line from history can be edited
+	}
+
+	e := newEditor(strings.NewReader(strings.Join(keys, "")), ioutil.Discard, testNames)
+	e.loadHistory(file)
+
+	lines, _ := readLines(e)
+	expected := []string{"first", "second", "second", "  ", "first", "new", "new!"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected lines %q, got %q", expected, lines)
+	}
+
+	history := []string{"first", "second", "first", "new", "new!"}
+	if !reflect.DeepEqual(e.history, history) {
+		t.Errorf("expected history %q, got %q", history, e.history)
+	}
+
+	// a later session starts with the saved history
+	e = newEditor(strings.NewReader("\x1b[A\x1b[A\r"), ioutil.Discard, testNames)
+	e.loadHistory(file)
+
+	if line, _ := e.readLine(PROMPT); line != "new" {
+		t.Errorf("expected the saved history to give new, got %q", line)
+	}
+}
+
+func TestHistoryTrimmed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "editor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, HISTORY_FILE)
+
+	var lines []string
+	for i := 0; i < maxHistory+10; i++ {
+		lines = append(lines, strings.Repeat("x", i+1))
+	}
+	if err := ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := newEditor(strings.NewReader(""), ioutil.Discard, testNames)
+	e.loadHistory(file)
+
+	if len(e.history) != maxHistory || e.history[0] != lines[10] {
+		t.Errorf("expected the oldest lines to be dropped, got %d lines", len(e.history))
+	}
+
+	b, _ := ioutil.ReadFile(file)
+	if n := strings.Count(string(b), "\n"); n != maxHistory {
+		t.Errorf("expected the file to be trimmed to %d lines, got %d", maxHistory, n)
+	}
+}
@@ -1,31 +1,243 @@
 package repl
 
 import (
-	"bufio"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
 
+	"github.com/sscaling/monkey/ast"
 	"github.com/sscaling/monkey/lexer"
+	"github.com/sscaling/monkey/object"
+	"github.com/sscaling/monkey/parser"
 	"github.com/sscaling/monkey/token"
 )
 
-func Start(in io.Reader, out io.Writer) {
+const (
+	PROMPT              = ">> "
+	CONTINUATION_PROMPT = ".. " // while brackets are still open
+)
+
+// engines which can run the input
+const (
+	EngineEval = "eval" // tree-walking evaluator
+	EngineVM   = "vm"   // bytecode compiler and virtual machine
+)
 
-	scanner := bufio.NewScanner(in)
+const help = `Commands:
+  :tokens <input>  print the tokens of the input
+  :ast <input>     print the parsed statements of the input
+  :env             list the bindings
+  :load <file>     run a file, keeping its bindings
+  :reset           remove all bindings
+  :help            show this help
+`
+
+// Start runs the input read from in, writing the results to out. Input
+// carries on over lines until its brackets balance, and lines starting with
+// : are commands (see :help). Bindings last until the input ends. When in is
+// a terminal lines can be edited, with history and tab completion.
+//
+// puts also writes to out, as object.Builtins.Out is set to it while input
+// runs, so only one session should run at a time.
+func Start(in io.Reader, out io.Writer, engine string) {
+	r := &repl{out: out, engine: engine, runner: newRunner(engine)}
+	lines := newLineReader(in, out, r.names)
 
 	for {
-		fmt.Printf(">> ")
-		scanned := scanner.Scan()
-		if !scanned {
+		input, ok := readInput(lines)
+		if !ok {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
+		r.handle(input)
+	}
+}
+
+type repl struct {
+	out    io.Writer
+	engine string
+	runner runner
+}
+
+// readInput reads lines until they make up a complete input. It's false
+// when there's no more input.
+func readInput(r lineReader) (string, bool) {
+	var lines []string
+	prompt := PROMPT
+
+	for {
+		line, err := r.readLine(prompt)
+		if err == errInterrupted {
+			lines, prompt = nil, PROMPT
+			continue
+		}
+		if err != nil {
+			break
+		}
+		lines = append(lines, line)
+
+		input := strings.Join(lines, "\n")
+		if complete(input) {
+			return input, true
+		}
+
+		prompt = CONTINUATION_PROMPT
+	}
+
+	// whatever was read before the end, the parser reports what's missing
+	return strings.Join(lines, "\n"), len(lines) > 0
+}
+
+// complete is whether input has no open brackets, strings or comments. Of
+// the commands only :tokens and :ast take code, which can carry on over
+// lines. Extra closing brackets are left for the parser to report.
+func complete(input string) bool {
+	if strings.HasPrefix(input, ":") {
+		name, src := splitCommand(input)
+		if name != "tokens" && name != "ast" {
+			return true
+		}
+		input = src
+	}
+
+	l := lexer.New(input)
+	depth := 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		}
+	}
+
+	for _, err := range l.Errors() {
+		if err.Code == lexer.ErrUnterminatedString || err.Code == lexer.ErrUnterminatedComment {
+			return false
+		}
+	}
+
+	return depth <= 0
+}
+
+func (r *repl) handle(input string) {
+	if strings.HasPrefix(input, ":") {
+		r.command(splitCommand(input))
+		return
+	}
+
+	r.run(input)
+}
+
+// run parses and runs src, printing its value
+func (r *repl) run(src string) {
+	program := r.parse(src)
+	if program == nil {
+		return
+	}
+
+	defer func(w io.Writer) { object.Builtins.Out = w }(object.Builtins.Out)
+	object.Builtins.Out = r.out
+
+	result := r.runner.run(program)
+	if result != nil {
+		fmt.Fprintln(r.out, result.Inspect())
+	}
+}
+
+// parse parses src, printing any errors, in which case the program is nil
+func (r *repl) parse(src string) *ast.Program {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		io.WriteString(r.out, parser.RenderErrors(src, p.Errors()))
+		return nil
+	}
+
+	return program
+}
+
+// names gives the words which tab completes: the keywords, builtins and
+// bindings
+func (r *repl) names() []string {
+	names := token.Keywords()
+	for _, b := range object.Builtins.All() {
+		names = append(names, b.Name)
+	}
+	for _, b := range r.runner.bindings() {
+		names = append(names, b.name)
+	}
+
+	return names
+}
 
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Printf("%+v\n", tok)
+// splitCommand splits ":name args" into the name and the rest of the input
+func splitCommand(input string) (string, string) {
+	input = strings.TrimPrefix(input, ":")
+
+	i := strings.IndexAny(input, " \t\n")
+	if i < 0 {
+		return input, ""
+	}
+
+	return input[:i], strings.TrimSpace(input[i:])
+}
+
+func (r *repl) command(name, args string) {
+	switch name {
+	case "tokens":
+		r.tokens(args)
+	case "ast":
+		if program := r.parse(args); program != nil {
+			for _, s := range program.Statements {
+				fmt.Fprintln(r.out, s.String())
+			}
+		}
+	case "env":
+		for _, b := range r.runner.bindings() {
+			fmt.Fprintf(r.out, "%s = %s\n", b.name, b.value.Inspect())
 		}
+	case "load":
+		r.load(args)
+	case "reset":
+		r.runner = newRunner(r.engine)
+	case "help":
+		io.WriteString(r.out, help)
+	default:
+		fmt.Fprintf(r.out, "unknown command :%s, see :help\n", name)
+	}
+}
 
+// tokens prints the tokens of src, with any errors the lexer found
+func (r *repl) tokens(src string) {
+	l := lexer.New(src, lexer.WithComments())
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintln(r.out, tok.Pretty())
 	}
+
+	for _, e := range l.Errors() {
+		err := &parser.ParseError{Code: e.Code, Message: e.Message, Line: e.Line, Column: e.Column, Offset: e.Offset}
+		io.WriteString(r.out, parser.RenderError(src, err))
+	}
+}
+
+// load runs the file named by filename, leaving its bindings for the rest of
+// the session. A leading #! line is split off and ignored, as by 'monkey run',
+// keeping its newline so error lines match the file.
+func (r *repl) load(filename string) {
+	if filename == "" {
+		fmt.Fprintln(r.out, ":load expects a file")
+		return
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(r.out, err)
+		return
+	}
+
+	_, src := SplitShebang(string(b))
+	r.run(src)
 }
@@ -0,0 +1,119 @@
+package repl
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2\n", ">> 3\n>> "},
+		{"let x = 2;\nx * 3\n", ">> >> 6\n>> "},
+		{"let add = fn(a, b) {\n  a + b\n};\nadd(1,\n2)\n", ">> .. .. >> .. 3\n>> "},
+		{"[1,\n2", ">> .. .. error[P001] 2:2: expected next token to be ], got EOF instead\n  2 | 2\n    |  ^\n>> "},
+		{"\"a\nb\"\n", ">> .. a\nb\n>> "},
+		{"let = 1;\n", ">> error[P001] 1:5: expected next token to be IDENT, got = instead\n  1 | let = 1;\n    |     ^\n>> "},
+		{"1 + true\n", ">> ERROR: type mismatch: INTEGER + BOOLEAN\n>> "},
+		{"puts(\"hi\", 1)\n", ">> hi\n1\nnull\n>> "},
+		{"let f = fn(x) { puts(x); x };\nmap([1, 2], f)\n", ">> >> 1\n2\n[1, 2]\n>> "},
+	}
+
+	for _, engine := range []string{EngineEval, EngineVM} {
+		for _, tt := range tests {
+			var out bytes.Buffer
+			Start(strings.NewReader(tt.input), &out, engine)
+
+			if out.String() != tt.expected {
+				t.Errorf("%s %q: expected %q, got %q", engine, tt.input, tt.expected, out.String())
+			}
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "lib.mk")
+	if err := ioutil.WriteFile(file, []byte("#!/usr/bin/env monkey\nlet double = fn(x) { x * 2 };\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":tokens let x\n", ">> LET 'let' [1:1]\nIDENT 'x' [1:5]\n>> "},
+		{":tokens (1,\n2)\n", ">> .. ( '(' [1:1]\nINTEGER '1' [1:2]\n, ',' [1:3]\nINTEGER '2' [2:1]\n) ')' [2:2]\n>> "},
+		{":ast 1 + 2 * 3; let y = -x\n", ">> (1 + (2 * 3))\nlet y = (-x);\n>> "},
+		{"let b = 2; let a = \"s\";\n:env\n", ">> >> a = s\nb = 2\n>> "},
+		{":load " + file + "\ndouble(4)\n", ">> >> 8\n>> "},
+		{":load\n", ">> :load expects a file\n>> "},
+		{"let a = 1;\n:reset\n:env\na\n", ">> >> >> >> ERROR: identifier not found: a\n>> "},
+		{"let f = fn(x) { x * 2 };\n:env\nf\n", ">> >> f = fn(x) {\n(x * 2)\n}\n>> fn(x) {\n(x * 2)\n}\n>> "},
+		{":help\n", ">> " + help + ">> "},
+		{":nope\n", ">> unknown command :nope, see :help\n>> "},
+	}
+
+	for _, engine := range []string{EngineEval, EngineVM} {
+		for _, tt := range tests {
+			var out bytes.Buffer
+			Start(strings.NewReader(tt.input), &out, engine)
+
+			if out.String() != tt.expected {
+				t.Errorf("%s %q: expected %q, got %q", engine, tt.input, tt.expected, out.String())
+			}
+		}
+	}
+}
+
+func TestVMCompileError(t *testing.T) {
+	// none of the input runs, so nothing is bound, unlike in the evaluator
+	input := "let a = 1; b\na\nlet a = 2; a\n:env\n"
+	expected := ">> ERROR: identifier not found: b\n>> ERROR: identifier not found: a\n>> 2\n>> a = 2\n>> "
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out, EngineVM)
+
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+// lines is a lineReader giving each of its lines in turn, or the error
+type lines []struct {
+	line string
+	err  error
+}
+
+func (l *lines) readLine(prompt string) (string, error) {
+	if len(*l) == 0 {
+		return "", io.EOF
+	}
+
+	next := (*l)[0]
+	*l = (*l)[1:]
+	return next.line, next.err
+}
+
+func TestReadInputInterrupted(t *testing.T) {
+	r := &lines{{"let f = fn() {", nil}, {"", errInterrupted}, {"1 + 2", nil}}
+
+	if input, ok := readInput(r); !ok || input != "1 + 2" {
+		t.Errorf("expected the interrupted input to be dropped, got %q", input)
+	}
+	if _, ok := readInput(r); ok {
+		t.Errorf("expected the end of the input")
+	}
+}
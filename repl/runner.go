@@ -0,0 +1,103 @@
+package repl
+
+import (
+	"github.com/sscaling/monkey/ast"
+	"github.com/sscaling/monkey/compiler"
+	"github.com/sscaling/monkey/evaluator"
+	"github.com/sscaling/monkey/object"
+	"github.com/sscaling/monkey/vm"
+)
+
+// runner runs programs with one of the engines, keeping bindings between
+// runs
+type runner interface {
+	run(program *ast.Program) object.Object
+
+	// bindings gives the values bound so far, ordered by name
+	bindings() []binding
+}
+
+type binding struct {
+	name  string
+	value object.Object
+}
+
+func newRunner(engine string) runner {
+	if engine == EngineVM {
+		return newVMRunner()
+	}
+
+	return &evalRunner{env: object.NewEnvironment()}
+}
+
+type evalRunner struct {
+	env *object.Environment
+}
+
+func (r *evalRunner) run(program *ast.Program) object.Object {
+	return evaluator.Eval(program, r.env)
+}
+
+func (r *evalRunner) bindings() []binding {
+	bindings := []binding{}
+	for _, name := range r.env.Names() {
+		value, _ := r.env.Get(name)
+		bindings = append(bindings, binding{name, value})
+	}
+
+	return bindings
+}
+
+type vmRunner struct {
+	constants   []object.Object
+	globals     []object.Object
+	symbolTable *compiler.SymbolTable
+}
+
+func newVMRunner() *vmRunner {
+	symbolTable := compiler.NewSymbolTable()
+	for i, b := range object.Builtins.All() {
+		symbolTable.DefineBuiltin(i, b.Name)
+	}
+
+	return &vmRunner{
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalsSize),
+		symbolTable: symbolTable,
+	}
+}
+
+func (r *vmRunner) run(program *ast.Program) object.Object {
+	// nothing is kept from input which doesn't compile, as none of it runs
+	symbolTable := r.symbolTable.Copy()
+	comp := compiler.NewWithState(symbolTable, r.constants)
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	bytecode := comp.Bytecode()
+	r.symbolTable, r.constants = symbolTable, bytecode.Constants
+
+	machine := vm.NewWithGlobalsStore(bytecode, r.globals)
+	if err := machine.Run(); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	if !HasValue(program) {
+		return nil
+	}
+
+	return machine.LastPoppedStackElem()
+}
+
+// a global which failed to be set, i.e. because of an error, isn't listed
+func (r *vmRunner) bindings() []binding {
+	bindings := []binding{}
+	for _, s := range r.symbolTable.Symbols() {
+		if s.Scope == compiler.GlobalScope && r.globals[s.Index] != nil {
+			bindings = append(bindings, binding{s.Name, r.globals[s.Index]})
+		}
+	}
+
+	return bindings
+}
@@ -0,0 +1,37 @@
+package repl
+
+import (
+	"strings"
+
+	"github.com/sscaling/monkey/ast"
+)
+
+// SplitShebang splits off a leading #! line, which a program run as a
+// script starts with, giving "" for shebang if there isn't one. rest keeps
+// the newline ending the line, so line numbers within it match those of src.
+func SplitShebang(src string) (shebang, rest string) {
+	if !strings.HasPrefix(src, "#!") {
+		return "", src
+	}
+
+	i := strings.IndexByte(src, '\n')
+	if i < 0 {
+		return src, ""
+	}
+
+	return src[:i], src[i:]
+}
+
+// HasValue is whether running program gives a value to print. It doesn't if
+// it's empty or ends with a let statement, which is how the evaluator works
+// and how the vm, whose last popped value is whatever came before, is made to
+// match it.
+func HasValue(program *ast.Program) bool {
+	n := len(program.Statements)
+	if n == 0 {
+		return false
+	}
+
+	_, isLet := program.Statements[n-1].(*ast.LetStatement)
+	return !isLet
+}
@@ -0,0 +1,51 @@
+package repl
+
+import (
+	"testing"
+
+	"github.com/sscaling/monkey/lexer"
+	"github.com/sscaling/monkey/parser"
+)
+
+func TestSplitShebang(t *testing.T) {
+	tests := []struct {
+		src     string
+		shebang string
+		rest    string
+	}{
+		{"", "", ""},
+		{"1 + 2", "", "1 + 2"},
+		{"#!/usr/bin/env monkey\nputs(1);\n", "#!/usr/bin/env monkey", "\nputs(1);\n"},
+		{"#!/usr/bin/env monkey", "#!/usr/bin/env monkey", ""},
+		{"let a = 1;\n#!x", "", "let a = 1;\n#!x"},
+	}
+
+	for _, tt := range tests {
+		shebang, rest := SplitShebang(tt.src)
+		if shebang != tt.shebang || rest != tt.rest {
+			t.Errorf("%q: expected %q and %q, got %q and %q", tt.src, tt.shebang, tt.rest, shebang, rest)
+		}
+	}
+}
+
+func TestHasValue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"", false},
+		{"1", true},
+		{"let a = 1;", false},
+		{"let a = 1; a", true},
+		{"a; let b = 2;", false},
+		{"return 1;", true},
+		{"if (true) { let a = 1 }", true},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		if HasValue(program) != tt.expected {
+			t.Errorf("%q: expected %t", tt.input, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package repl
+
+import "errors"
+
+// without raw mode the line editor isn't used, input is read a line at a time
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
@@ -0,0 +1,205 @@
+package token
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Pos is a position within a FileSet: the byte offset into a file plus the
+// base of that file. Input lexed without a file has a base of 0, so its
+// positions are just byte offsets.
+type Pos int
+
+// NoPos is used where there is no position, i.e. a missing else block
+const NoPos Pos = -1
+
+func (p Pos) IsValid() bool {
+	return p != NoPos
+}
+
+// Position is a Pos expanded to something readable
+type Position struct {
+	Filename string // may be empty
+	Offset   int    // in bytes, starting at 0
+	Line     int    // starting at 1
+	Column   int    // starting at 1, in characters (see NextColumn)
+}
+
+func (pos Position) IsValid() bool {
+	return pos.Line > 0
+}
+
+// String returns file:line:column, or line:column when there is no filename
+func (pos Position) String() string {
+	if !pos.IsValid() {
+		if pos.Filename != "" {
+			return pos.Filename
+		}
+		return "-"
+	}
+
+	s := fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	if pos.Filename != "" {
+		s = pos.Filename + ":" + s
+	}
+
+	return s
+}
+
+// NextColumn is the column following a character r at column. Columns count
+// characters rather than bytes, except that a tab moves on to the next tab
+// stop, every tabWidth columns, and a carriage return takes up no space.
+func NextColumn(column int, r rune, tabWidth int) int {
+	switch r {
+	case '\r':
+		return column
+	case '\t':
+		if tabWidth > 1 {
+			return ((column-1)/tabWidth+1)*tabWidth + 1
+		}
+	}
+
+	return column + 1
+}
+
+// File is a source file added to a FileSet
+type File struct {
+	name     string
+	base     int
+	src      string
+	lines    []int // offset of the first byte of each line
+	tabWidth int
+}
+
+func newFile(name string, base int, src string) *File {
+	f := &File{name: name, base: base, src: src, lines: []int{0}, tabWidth: 1}
+
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			f.lines = append(f.lines, i+1)
+		}
+	}
+
+	return f
+}
+
+func (f *File) Name() string {
+	return f.name
+}
+
+func (f *File) Base() int {
+	return f.base
+}
+
+func (f *File) Size() int {
+	return len(f.src)
+}
+
+func (f *File) Source() string {
+	return f.src
+}
+
+func (f *File) LineCount() int {
+	return len(f.lines)
+}
+
+// TabWidth is the number of columns between tab stops, see NextColumn
+func (f *File) TabWidth() int {
+	return f.tabWidth
+}
+
+// SetTabWidth changes the tab width used for columns, which is 1 by default.
+// Set it before lexing the file so that tokens use it too.
+func (f *File) SetTabWidth(n int) {
+	if n > 0 {
+		f.tabWidth = n
+	}
+}
+
+// Pos returns the position of the given byte offset in the file
+func (f *File) Pos(offset int) Pos {
+	if offset < 0 || offset > f.Size() {
+		panic(fmt.Sprintf("offset %d out of range for file %s of size %d", offset, f.name, f.Size()))
+	}
+
+	return Pos(f.base + offset)
+}
+
+// Offset returns the byte offset in the file of p
+func (f *File) Offset(p Pos) int {
+	offset := int(p) - f.base
+	if offset < 0 || offset > f.Size() {
+		panic(fmt.Sprintf("pos %d out of range for file %s", p, f.name))
+	}
+
+	return offset
+}
+
+func (f *File) Position(p Pos) Position {
+	if !p.IsValid() {
+		return Position{Filename: f.name}
+	}
+
+	offset := f.Offset(p)
+
+	// the last line starting at or before offset
+	line := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset }) - 1
+	lineStart := f.lines[line]
+
+	column := 1
+	for _, r := range f.src[lineStart:offset] {
+		column = NextColumn(column, r, f.tabWidth)
+	}
+
+	return Position{
+		Filename: f.name,
+		Offset:   offset,
+		Line:     line + 1,
+		Column:   column,
+	}
+}
+
+// FileSet gives each file added to it a distinct range of positions, so a
+// Pos alone identifies both the file and the offset within it
+type FileSet struct {
+	base  int
+	files []*File
+}
+
+func NewFileSet() *FileSet {
+	return &FileSet{}
+}
+
+// AddFile adds src as the named file. Lex it with lexer.NewFile so that its
+// tokens have positions within the set.
+func (s *FileSet) AddFile(filename, src string) *File {
+	f := newFile(filename, s.base, src)
+
+	// the extra position is for the end of the file
+	s.base += len(src) + 1
+	s.files = append(s.files, f)
+
+	return f
+}
+
+// File returns the file containing p, or nil
+func (s *FileSet) File(p Pos) *File {
+	if !p.IsValid() {
+		return nil
+	}
+
+	i := sort.Search(len(s.files), func(i int) bool { return s.files[i].base > int(p) }) - 1
+	if i < 0 || int(p) > s.files[i].base+s.files[i].Size() {
+		return nil
+	}
+
+	return s.files[i]
+}
+
+func (s *FileSet) Position(p Pos) Position {
+	if f := s.File(p); f != nil {
+		return f.Position(p)
+	}
+
+	return Position{}
+}
@@ -0,0 +1,92 @@
+package token
+
+import "testing"
+
+func TestFileSetPosition(t *testing.T) {
+	fset := NewFileSet()
+	a := fset.AddFile("a.mk", "let x = 1;\nlet y = 2;\n")
+	b := fset.AddFile("b.mk", "x\r\n  + y")
+
+	tests := []struct {
+		pos      Pos
+		expected string
+	}{
+		{a.Pos(0), "a.mk:1:1"},
+		{a.Pos(4), "a.mk:1:5"},
+		{a.Pos(11), "a.mk:2:1"},
+		{a.Pos(21), "a.mk:2:11"},
+		{a.Pos(22), "a.mk:3:1"},
+		{b.Pos(0), "b.mk:1:1"},
+		{b.Pos(5), "b.mk:2:3"},
+		{b.Pos(8), "b.mk:2:6"},
+		{NoPos, "-"},
+	}
+
+	for _, tt := range tests {
+		actual := fset.Position(tt.pos).String()
+		if actual != tt.expected {
+			t.Errorf("pos %d: expected %s, got %s", tt.pos, tt.expected, actual)
+		}
+	}
+
+	if b.Base() != a.Size()+1 {
+		t.Errorf("expected b to start after the end of a, got base %d", b.Base())
+	}
+
+	if f := fset.File(b.Pos(3)); f != b {
+		t.Errorf("expected pos %d to be in b.mk, got %v", b.Pos(3), f)
+	}
+
+	if offset := b.Offset(b.Pos(3)); offset != 3 {
+		t.Errorf("expected offset 3, got %d", offset)
+	}
+
+	if f := fset.File(Pos(1000)); f != nil {
+		t.Errorf("expected no file for pos 1000, got %s", f.Name())
+	}
+}
+
+func TestFileColumns(t *testing.T) {
+	f := NewFileSet().AddFile("u.mk", "let π = \"世界\";\n\tx\n\t\tab\tc")
+
+	tests := []struct {
+		offset   int
+		tabWidth int
+		expected string
+	}{
+		{6, 1, "u.mk:1:6"},
+		{10, 1, "u.mk:1:10"},
+		{17, 1, "u.mk:1:13"},
+		{20, 1, "u.mk:2:2"},
+		{20, 4, "u.mk:2:5"},
+		{24, 4, "u.mk:3:9"},
+		{27, 4, "u.mk:3:13"},
+		{27, 8, "u.mk:3:25"},
+	}
+
+	for _, tt := range tests {
+		f.SetTabWidth(tt.tabWidth)
+		actual := f.Position(f.Pos(tt.offset)).String()
+		if actual != tt.expected {
+			t.Errorf("offset %d, tab width %d: expected %s, got %s", tt.offset, tt.tabWidth, tt.expected, actual)
+		}
+	}
+}
+
+func TestPositionString(t *testing.T) {
+	tests := []struct {
+		pos      Position
+		expected string
+	}{
+		{Position{Filename: "x.mk", Line: 3, Column: 4}, "x.mk:3:4"},
+		{Position{Line: 3, Column: 4}, "3:4"},
+		{Position{Filename: "x.mk"}, "x.mk"},
+		{Position{}, "-"},
+	}
+
+	for _, tt := range tests {
+		if tt.pos.String() != tt.expected {
+			t.Errorf("expected %s, got %s", tt.expected, tt.pos.String())
+		}
+	}
+}
@@ -1,15 +1,24 @@
 package token
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 type TokenType string
 
 type Token struct {
-	Type     TokenType
-	Literal  string
+	Type    TokenType
+	Literal string
+
+	// Position and End are the byte offsets of the first character of the
+	// token, and the one just after it. When lexed from a File they include
+	// its base, so are really a Pos within the FileSet.
 	Position int
-	Line     int
-	Column   int
+	End      int
+
+	Line   int
+	Column int
 }
 
 func (t Token) String() string {
@@ -23,6 +32,9 @@ func (t Token) Pretty() string {
 const (
 	IDENT   = "IDENT" // foo, bar etc
 	INTEGER = "INTEGER"
+	FLOAT   = "FLOAT"
+	STRING  = "STRING"
+	COMMENT = "COMMENT" // the literal is the whole comment, i.e. "// foo"
 
 	ASSIGN       = "="
 	EQUALS       = "=="
@@ -34,15 +46,23 @@ const (
 	DIVIDE       = "/"
 	LESS_THAN    = "<"
 	GREATER_THAN = ">"
+	LT_EQ        = "<="
+	GT_EQ        = ">="
+	AND          = "&&"
+	OR           = "||"
 
 	COMMA      = ","
 	SEMI_COLON = ";"
+	COLON      = ":"
 
 	LPAREN = "("
 	RPAREN = ")"
 	LBRACE = "{"
 	RBRACE = "}"
 
+	LBRACKET = "["
+	RBRACKET = "]"
+
 	// keywords
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
@@ -66,6 +86,17 @@ var keywords = map[string]TokenType{
 	"return": RETURN,
 }
 
+// Keywords returns the keywords of the language, in order
+func Keywords() []string {
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
 func LookupIdentifier(identifier string) TokenType {
 	tok, ok := keywords[identifier]
 	if ok {
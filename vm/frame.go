@@ -0,0 +1,21 @@
+package vm
+
+import (
+	"github.com/sscaling/monkey/code"
+	"github.com/sscaling/monkey/object"
+)
+
+// Frame is the call frame of a function being executed
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int // stack pointer before the call, locals live above it
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,704 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sscaling/monkey/code"
+	"github.com/sscaling/monkey/compiler"
+	"github.com/sscaling/monkey/object"
+)
+
+const (
+	StackSize   = 2048 // to start with, it grows as calls need more
+	GlobalsSize = 65536
+
+	// the main program's frame and one for each call in progress
+	MaxFrames = object.MaxCallDepth + 1
+)
+
+// there is only ever one instance of each of these, so they can be compared by reference
+var (
+	Null  = object.NULL
+	True  = object.TRUE
+	False = object.FALSE
+)
+
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // always points to the next free slot, the top of stack is stack[sp-1]
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int
+
+	ec *object.EvalContext // limits of the current run, nil for none
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFrame := NewFrame(&object.Closure{Fn: mainFn}, 0)
+
+	frames := make([]*Frame, 1, 64)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants: bytecode.Constants,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals: make([]object.Object, GlobalsSize),
+
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// NewWithGlobalsStore creates a vm which shares globals with a previous run, i.e. for the repl
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// LastPoppedStackElem is the value of the last expression statement executed
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) Run() error {
+	return vm.run(0)
+}
+
+// RunWithContext runs the program, stopping with an *object.LimitError once
+// it exceeds the limits of ec
+func (vm *VM) RunWithContext(ec *object.EvalContext) error {
+	vm.ec = ec
+	defer func() { vm.ec = nil }()
+
+	return vm.run(0)
+}
+
+// run executes instructions until the frame at depth+1 returns (which for
+// the main program is when it runs out of instructions)
+func (vm *VM) run(depth int) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.framesIndex > depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		if err := vm.ec.Step(); err != nil {
+			return err
+		}
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(vm.constants[constIndex]); err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpGreaterThanOrEqual, code.OpLessThanOrEqual:
+			if err := vm.executeBinaryOperation(op); err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			if err := vm.push(True); err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			if err := vm.push(False); err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		case code.OpBang:
+			if err := vm.executeBangOperator(); err != nil {
+				return err
+			}
+
+		case code.OpMinus:
+			if err := vm.executeMinusOperator(); err != nil {
+				return err
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			// the loop increments ip before the next instruction is read
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			global := vm.globals[globalIndex]
+			if global == nil {
+				return fmt.Errorf("global %d used before it was bound", globalIndex)
+			}
+			if err := vm.push(global); err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			local := vm.stack[frame.basePointer+int(localIndex)]
+			if local == nil {
+				return fmt.Errorf("local %d used before it was bound", localIndex)
+			}
+			if err := vm.push(local); err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.callFunction(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			if vm.framesIndex == 1 {
+				// return from the main program, leave the value as the last popped
+				vm.currentFrame().ip = len(ins) - 1
+				continue
+			}
+
+			frame := vm.popFrame()
+			// also drop the function itself, which sits below the base pointer
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := int(code.ReadUint8(ins[ip+3:]))
+			vm.currentFrame().ip += 3
+
+			if err := vm.pushClosure(int(constIndex), numFree); err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.push(vm.currentFrame().cl.Free[freeIndex]); err != nil {
+				return err
+			}
+
+		case code.OpCurrentClosure:
+			if err := vm.push(vm.currentFrame().cl); err != nil {
+				return err
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+
+			if err := vm.pushAllocated(&object.Array{Elements: elements}); err != nil {
+				return err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp -= numElements
+
+			if err := vm.pushAllocated(hash); err != nil {
+				return err
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeIndexExpression(left, index); err != nil {
+				return err
+			}
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(object.Builtins.At(int(builtinIndex))); err != nil {
+				return err
+			}
+
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("unhandled opcode %s", def.Name)
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) callFunction(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	if builtin, ok := callee.(*object.Builtin); ok {
+		return vm.callBuiltin(builtin, numArgs)
+	}
+
+	cl, ok := callee.(*object.Closure)
+	if !ok {
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+	fn := cl.Fn
+
+	if numArgs != fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", fn.NumParameters, numArgs)
+	}
+
+	if vm.framesIndex >= MaxFrames {
+		return &object.LimitError{Limit: object.LimitDepth, Max: object.MaxCallDepth}
+	}
+
+	// every frame but the main program's is a call in progress, so the depth
+	// is checked here rather than counted with Enter and Leave
+	if max := vm.ec.MaxDepth(); max > 0 && vm.framesIndex > max {
+		return &object.LimitError{Limit: object.LimitDepth, Max: int64(max)}
+	}
+
+	// the arguments become the first locals
+	frame := NewFrame(cl, vm.sp-numArgs)
+	vm.grow(frame.basePointer + fn.NumLocals)
+	vm.pushFrame(frame)
+
+	// clear out whatever a previous call left behind in the slots of the
+	// remaining locals
+	for i := vm.sp; i < frame.basePointer+fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = frame.basePointer + fn.NumLocals
+
+	return nil
+}
+
+// pushClosure makes a closure of the function constant, capturing the free
+// variables on top of the stack
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	fn, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", vm.constants[constIndex])
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp -= numFree
+
+	return vm.push(&object.Closure{Fn: fn, Free: free})
+}
+
+// callBuiltin replaces the builtin and its arguments on the stack with the
+// result. Unlike the evaluator, the vm has no error values, so an error
+// stops the program.
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Call(vm.call, args...)
+	switch err := result.(type) {
+	case *object.Error:
+		return errors.New(err.Message)
+	case *object.LimitError:
+		return err
+	}
+
+	vm.sp = vm.sp - numArgs - 1
+
+	return vm.pushAllocated(result)
+}
+
+// call runs fn to completion on behalf of a builtin, i.e. the function given
+// to map, returning any error as an object for the builtin to pass back
+func (vm *VM) call(fn object.Object, args ...object.Object) object.Object {
+	depth := vm.framesIndex
+
+	err := vm.push(fn)
+	for _, a := range args {
+		if err == nil {
+			err = vm.push(a)
+		}
+	}
+	if err == nil {
+		err = vm.callFunction(len(args))
+	}
+	// a compiled function has pushed a frame, which needs running
+	if err == nil && vm.framesIndex > depth {
+		err = vm.run(depth)
+	}
+	if limitErr, ok := err.(*object.LimitError); ok {
+		return limitErr
+	}
+	if err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	return vm.pop()
+}
+
+// buildHash makes a hash of the keys and values alternating between
+// stack[start] and stack[end-1]
+func (vm *VM) buildHash(start, end int) (object.Object, error) {
+	hash := object.NewHash()
+
+	for i := start; i < end; i += 2 {
+		key, ok := vm.stack[i].(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", vm.stack[i].Type())
+		}
+
+		hash.Set(key, vm.stack[i+1])
+	}
+
+	return hash, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		return vm.executeArrayIndex(left, index)
+	case *object.Hash:
+		return vm.executeHashIndex(left, index)
+	default:
+		return fmt.Errorf("index operator not supported: %s", left.Type())
+	}
+}
+
+// an index outside the array, including a negative one, gives null
+func (vm *VM) executeArrayIndex(arr *object.Array, index object.Object) error {
+	i, ok := index.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+	}
+
+	if i.Value < 0 || i.Value >= int64(len(arr.Elements)) {
+		return vm.push(Null)
+	}
+
+	return vm.push(arr.Elements[i.Value])
+}
+
+// a key which isn't set gives null
+func (vm *VM) executeHashIndex(hash *object.Hash, index object.Object) error {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+
+	if value, ok := hash.Get(key); ok {
+		return vm.push(value)
+	}
+
+	return vm.push(Null)
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		// at least one is a float, the other is promoted
+		return vm.executeBinaryFloatOperation(op, left, right)
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(op, left, right)
+	case leftType != rightType:
+		return fmt.Errorf("type mismatch: %s %s %s", leftType, operators[op], rightType)
+	// booleans and null are singletons, so pointer comparison is enough
+	case op == code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", leftType, operators[op], rightType)
+	}
+}
+
+// operators gives the source form of each binary opcode, for error messages
+var operators = map[code.Opcode]string{
+	code.OpAdd:                "+",
+	code.OpSub:                "-",
+	code.OpMul:                "*",
+	code.OpDiv:                "/",
+	code.OpEqual:              "==",
+	code.OpNotEqual:           "!=",
+	code.OpGreaterThan:        ">",
+	code.OpLessThan:           "<",
+	code.OpGreaterThanOrEqual: ">=",
+	code.OpLessThanOrEqual:    "<=",
+}
+
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
+	l := left.(*object.Integer).Value
+	r := right.(*object.Integer).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Integer{Value: l + r})
+	case code.OpSub:
+		return vm.push(&object.Integer{Value: l - r})
+	case code.OpMul:
+		return vm.push(&object.Integer{Value: l * r})
+	case code.OpDiv:
+		if r == 0 {
+			return fmt.Errorf("division by zero: %d / %d", l, r)
+		}
+		return vm.push(&object.Integer{Value: l / r})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(l == r))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(l != r))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(l > r))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(l < r))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(l >= r))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(l <= r))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, left, right object.Object) error {
+	l := toFloat(left)
+	r := toFloat(right)
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Float{Value: l + r})
+	case code.OpSub:
+		return vm.push(&object.Float{Value: l - r})
+	case code.OpMul:
+		return vm.push(&object.Float{Value: l * r})
+	case code.OpDiv:
+		if r == 0 {
+			return fmt.Errorf("division by zero: %s / %s", left.Inspect(), right.Inspect())
+		}
+		return vm.push(&object.Float{Value: l / r})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(l == r))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(l != r))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(l > r))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(l < r))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(l >= r))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(l <= r))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat gives the value of an Integer or Float as a float64
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+
+	return obj.(*object.Float).Value
+}
+
+func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
+	l := left.(*object.String).Value
+	r := right.(*object.String).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.pushAllocated(&object.String{Value: l + r})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(l == r))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(l != r))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+// !<expr> is true only for false and null, everything else is 'truthy'
+func (vm *VM) executeBangOperator() error {
+	operand := vm.pop()
+
+	switch operand {
+	case False, Null:
+		return vm.push(True)
+	default:
+		return vm.push(False)
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	switch operand := vm.pop().(type) {
+	case *object.Integer:
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return fmt.Errorf("unknown operator: -%s", operand.Type())
+	}
+}
+
+func (vm *VM) push(o object.Object) error {
+	vm.grow(vm.sp + 1)
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+// grow makes the stack at least size long, doubling it as needed. Its size
+// is bounded by MaxFrames, as within a frame it only holds the locals and the
+// operands of the function's expressions.
+func (vm *VM) grow(size int) {
+	if size <= len(vm.stack) {
+		return
+	}
+
+	n := 2 * len(vm.stack)
+	for n < size {
+		n *= 2
+	}
+
+	stack := make([]object.Object, n)
+	copy(stack, vm.stack)
+	vm.stack = stack
+}
+
+// pushAllocated pushes a new string, array or hash, counting its size
+// against the allocation limit. A builtin's result is counted in full.
+func (vm *VM) pushAllocated(o object.Object) error {
+	if err := vm.ec.Alloc(o); err != nil {
+		return err
+	}
+
+	return vm.push(o)
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// null and false are the only falsy values
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case Null, False:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
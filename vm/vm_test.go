@@ -0,0 +1,512 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sscaling/monkey/ast"
+	"github.com/sscaling/monkey/compiler"
+	"github.com/sscaling/monkey/evaluator"
+	"github.com/sscaling/monkey/lexer"
+	"github.com/sscaling/monkey/object"
+	"github.com/sscaling/monkey/parser"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-50 + 100 + -50", 0},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5", 1.5},
+		{"1.5 + 2", 3.5},
+		{"2 - 0.5", 1.5},
+		{"-1.5 * 2", -3.0},
+		{"1 / 4.0", 0.25},
+		{"0.5 < 1", true},
+		{"1 >= 1.0", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"!true", false},
+		{"!5", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+		{"1 <= 1", true},
+		{"2 >= 3", false},
+		{"true && 5", true},
+		{"5 && false", false},
+		{"false || 0", true},
+		{"if (false) { 1 } || false", false},
+		{"false && 1 / 0", false},
+		{"true || 1 / 0", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1 > 2) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { let a = 1; }", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let a = 1; let a = a + 1; a", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{`"a" == "a"`, true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let one = fn() { 1; }; let two = fn() { 2; }; one() + two()", 3},
+		{"let earlyExit = fn() { return 99; 100; }; earlyExit();", 99},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{"let globalNum = 10; let f = fn(a) { let num = 1; globalNum - num - a }; f(2)", 7},
+		{"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(15)", 610},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(3)", 5},
+		{"let add = fn(x) { fn(y) { fn(z) { x + y + z } } }; add(1)(2)(3)", 6},
+		{"let newAdder = fn(a, b) { let c = a + b; fn(d) { c + d } }; let f = newAdder(1, 2); f(8)", 11},
+		{"let compose = fn(f, g) { fn(x) { g(f(x)) } }; compose(fn(x) { x + 1 }, fn(x) { x * 2 })(3)", 8},
+		{"let apply = fn(f, x) { f(x) }; apply(fn(x) { x * x }, 4)", 16},
+		{"let twice = fn(f) { fn(x) { f(f(x)) } }; twice(twice(fn(x) { x + 3 }))(0)", 12},
+		{"let x = 1; let f = fn() { x }; let g = fn(x) { f() }; g(2)", 1},
+		{"let make = fn(n) { [fn() { n }, fn() { n * 2 }] }; let fs = make(4); fs[0]() + fs[1]()", 12},
+		{"let n = 3; map([1, 2], fn(x) { fn(y) { x * y + n } })[1](10)", 23},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let countDown = fn(x) { if (x == 0) { return 0; } countDown(x - 1) }; countDown(3)", 0},
+		{"let wrapper = fn() { let countDown = fn(x) { if (x == 0) { 0 } else { countDown(x - 1) } }; countDown(5) }; wrapper()", 0},
+		{"let wrapper = fn(n) { let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } }; fib(n) }; wrapper(10)", 55},
+		{"let sumTo = fn(n) { let go = fn(i, acc) { if (i > n) { acc } else { go(i + 1, acc + i) } }; go(1, 0) }; sumTo(10)", 55},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArrays(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2 + 3, 4 * 5]", []int{1, 5, 20}},
+		{"[1, 2, 3][1]", 2},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"let a = [1, 2]; a[0] + a[1]", 3},
+		{"[1, 2, 3][3]", Null},
+		{"[1][-1]", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"{}", "{}"},
+		{"{1: 2, 2: 3}", "{1: 2, 2: 3}"},
+		{`{1 + 1: 2 * 2, "a": [1], true: {}}`, "{2: 4, a: [1], true: {}}"},
+		{`{"a": 1, "b": 2, "a": 3}`, "{a: 3, b: 2}"},
+	}
+
+	for _, tt := range tests {
+		vm := New(compile(t, tt.input))
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", tt.input, err)
+		}
+
+		result, ok := vm.LastPoppedStackElem().(*object.Hash)
+		if !ok || result.Inspect() != tt.expected {
+			t.Errorf("%q: expected hash %s, got %+v", tt.input, tt.expected, vm.LastPoppedStackElem())
+		}
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"{1: 1}[0]", Null},
+		{"{}[0]", Null},
+		{`let h = {"a": {"b": 5}}; h["a"]["b"]`, 5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("héllo")`, 5},
+		{"len([1, 2, 3])", 3},
+		{"first([])", Null},
+		{"last([1, 2, 3])", 3},
+		{"rest([1, 2, 3])", []int{2, 3}},
+		{"push([1], 2)", []int{1, 2}},
+		{"map([1, 2, 3], fn(x) { x * 2 })", []int{2, 4, 6}},
+		{"filter([1, 2, 3, 4], fn(x) { x > 2 })", []int{3, 4}},
+		{"reduce([1, 2, 3], 0, fn(acc, x) { acc + x })", 6},
+		{"let double = fn(x) { let y = x * 2; y }; map(map([1], double), double)", []int{4}},
+		{"let f = fn(a) { reduce(a, 0, fn(acc, x) { acc + len(x) }) }; f([[1], [2, 3]]) + 1", 4},
+		{"let len = fn(x) { 42 }; len([])", 42},
+		{"let sum = fn(a) { if (len(a) == 0) { 0 } else { first(a) + sum(rest(a)) } }; sum([1, 2, 3, 4])", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHostBuiltins(t *testing.T) {
+	object.Builtins.Register("vmTestTwice", func(args ...object.Object) (object.Object, error) {
+		i, ok := args[0].(*object.Integer)
+		if !ok {
+			return nil, fmt.Errorf("vmTestTwice wants an INTEGER, got %s", args[0].Type())
+		}
+		return &object.Integer{Value: i.Value * 2}, nil
+	}, object.WithArity(1))
+
+	// a Monkey function is given to Go as a func
+	object.Builtins.RegisterFunc("vmTestApply", func(f func(int64) int64, x int64) int64 {
+		return f(f(x))
+	})
+
+	runVmTests(t, []vmTestCase{
+		{"vmTestTwice(21)", 42},
+		{"map([1, 2], vmTestTwice)", []int{2, 4}},
+		{`type(fn() {})`, "FUNCTION"},
+		{"let n = 3; vmTestApply(fn(x) { x * n }, 2)", 18},
+		{"vmTestApply(vmTestTwice, 1) + 1", 5},
+	})
+
+	for input, expected := range map[string]string{
+		"vmTestTwice(true)":                  "vmTestTwice wants an INTEGER, got BOOLEAN",
+		"vmTestTwice(1, 2)":                  "wrong number of arguments: want=1, got=2",
+		"vmTestApply(fn(x) { x + true }, 1)": "type mismatch: INTEGER + BOOLEAN",
+		`vmTestApply(fn(x) { "a" }, 1)`:      "cannot use STRING as int64",
+		"vmTestApply(1, 1)":                  "argument 1 to `vmTestApply`: cannot use INTEGER as func(int64) int64",
+	} {
+		err := New(compile(t, input)).Run()
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { 1; }(1);", "wrong number of arguments: want=0, got=1"},
+		{"1();", "not a function: INTEGER"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{`"a" - "b"`, "unknown operator: STRING - STRING"},
+		{"1 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"1 / 0", "division by zero: 1 / 0"},
+		{"len(1)", "argument to `len` not supported, got INTEGER"},
+		{"map([1], fn(x) { x + true })", "type mismatch: INTEGER + BOOLEAN"},
+		{"map([1], fn() { 1 })", "wrong number of arguments: want=0, got=1"},
+		{"1[0]", "index operator not supported: INTEGER"},
+		{"{[]: 1}", "unusable as hash key: ARRAY"},
+		{"{1: 1}[1.5]", "unusable as hash key: FLOAT"},
+	}
+
+	for _, tt := range tests {
+		vm := New(compile(t, tt.input))
+
+		err := vm.Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		input    string
+		ctx      context.Context
+		limits   object.Limits
+		expected object.Limit
+	}{
+		{"let f = fn(x) { f(x) }; f(1)", nil, object.Limits{MaxSteps: 1000}, object.LimitSteps},
+		{"map([1, 2, 3], fn(x) { let f = fn() { f() }; f() })", nil, object.Limits{MaxSteps: 1000}, object.LimitSteps},
+		{"let f = fn(x) { f(x + 1) }; f(0)", nil, object.Limits{MaxDepth: 100}, object.LimitDepth},
+		{"map([1], fn(x) { let f = fn(x) { f(x + 1) }; f(0) })", nil, object.Limits{MaxDepth: 100}, object.LimitDepth},
+		{"let f = fn() { f() }; f()", nil, object.Limits{}, object.LimitDepth},
+		{"let f = fn() { f() }; f()", nil, object.Limits{MaxDepth: 2 * object.MaxCallDepth}, object.LimitDepth},
+		{`let grow = fn(s) { grow(s + s) }; grow("ab")`, nil, object.Limits{MaxAlloc: 1 << 20}, object.LimitAlloc},
+		{"let grow = fn(a) { grow(push(a, a)) }; grow([])", nil, object.Limits{MaxAlloc: 10000}, object.LimitAlloc},
+		{"let grow = fn(h, i) { grow({i: h, 0: i}, i + 1) }; grow({}, 0)", nil, object.Limits{MaxAlloc: 10000}, object.LimitAlloc},
+		{"[1, 2, 3]", cancelled, object.Limits{}, object.LimitContext},
+	}
+
+	for _, tt := range tests {
+		vm := New(compile(t, tt.input))
+		err := vm.RunWithContext(object.NewEvalContext(tt.ctx, tt.limits))
+
+		var limitErr *object.LimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("%q: expected a limit error, got %v", tt.input, err)
+			continue
+		}
+		if limitErr.Limit != tt.expected {
+			t.Errorf("%q: expected the %s limit, got %s", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestLimitsTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	vm := New(compile(t, "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; f(50)"))
+
+	if err := vm.RunWithContext(object.NewEvalContext(ctx, object.Limits{})); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+}
+
+func TestWithinLimits(t *testing.T) {
+	ec := object.NewEvalContext(context.Background(), object.Limits{MaxSteps: 10000, MaxDepth: 20, MaxAlloc: 1000})
+
+	vm := New(compile(t, `let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; [fact(10), "a" + "b"]`))
+	if err := vm.RunWithContext(ec); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if actual := vm.LastPoppedStackElem().Inspect(); actual != "[3628800, ab]" {
+		t.Errorf("expected [3628800, ab], got %s", actual)
+	}
+	if ec.Steps() == 0 {
+		t.Errorf("expected the steps to be counted")
+	}
+}
+
+// TestMatchesEvaluator runs each program with both engines and expects the same output
+func TestMatchesEvaluator(t *testing.T) {
+	inputs := []string{
+		"5 + 5 * 2 - 10 / 2",
+		"let a = 5; let b = a * 2; if (b > a) { b } else { a }",
+		"let max = fn(a, b) { if (a > b) { a } else { b } }; max(3, 7) + max(9, 2)",
+		`let greet = fn(name) { "Hello, " + name + "!" }; greet("monkey")`,
+		"if (false) { 1 }",
+		"return 1; 2",
+		"9; return 2 * 5; 9;",
+		"if (10 > 1) { if (10 > 1) { return 10; } return 1; }",
+		"let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(10)",
+		"!!(1 == 1) == true",
+		"1 + true",
+		"-true",
+		`"a" * "b"`,
+		"5 / 0",
+		"fn(x) { x }(1, 2)",
+		"let between = fn(x, lo, hi) { x >= lo && x <= hi }; between(5, 1, 10) || between(5, 6, 7)",
+		"1 < 2 && 2 > 3 || 3 >= 3 && !(4 <= 4)",
+		"let a = 2; a > 1 && a * 2",
+		"true && (1 + true)",
+		"false || -true",
+		`"a" <= "b"`,
+		"let mean = fn(a, b) { (a + b) / 2.0 }; mean(3, 4) * 1e2",
+		"0.1 + 0.2 == 0.3",
+		"-(2.5) <= -2",
+		"1.5 / 0",
+		"1.5 + true",
+		"[1, 2 * 3, [4]]",
+		"let a = [1, 2, 3]; a[0] + a[2] + len(a)",
+		"[1][1]",
+		"[1][-1]",
+		`[1]["a"]`,
+		"first(rest(push([1, 2], 3)))",
+		"map(filter([1, 2, 3, 4], fn(x) { x > 1 }), fn(x) { x * x })",
+		"reduce([1, 2, 3], 1, fn(acc, x) { acc * x })",
+		"map([1, 0], fn(x) { 1 / x })",
+		"filter([1], 1)",
+		"reduce([], 0)",
+		"len",
+		`let people = [{"name": "Alice", "age": 24}, {"name": "Anna", "age": 28}]; map(people, fn(p) { p["name"] })`,
+		`let h = {"b": 1, "a": 2, 3: true}; [keys(h), values(h), len(h)]`,
+		`let h = {"a": 1}; [has(h, "a"), has(h, "b"), delete(h, "a"), h]`,
+		`{false: 1}[1 > 2] + {"x": 2}["x"]`,
+		`{"a": 1}[[]]`,
+		"let newAdder = fn(x) { fn(y) { x + y } }; [newAdder(1)(2), newAdder(3)(4)]",
+		"let curry = fn(f) { fn(a) { fn(b) { f(a, b) } } }; curry(fn(a, b) { a - b })(10)(3)",
+		"let f = fn(x) { fn() { x + true } }; f(1)()",
+		"if (true) { let x = 1 }",
+		"(if (true) { let x = 1 }) + 1",
+		"[if (true) { }, if (false) { 1 } else { let y = 2; }]",
+		"let wrapper = fn() { let even = fn(n) { if (n == 0) { true } else { !even(n - 1) } }; even(7) }; wrapper()",
+		"let down = fn(n) { if (n == 0) { 0 } else { down(n - 1) } }; down(2000)",
+		fmt.Sprintf("let down = fn(n) { if (n == 0) { 0 } else { down(n - 1) } }; down(%d)", object.MaxCallDepth-1),
+		fmt.Sprintf("let down = fn(n) { if (n == 0) { 0 } else { down(n - 1) } }; down(%d)", object.MaxCallDepth),
+		"let sum = fn(a) { if (len(a) == 0) { 0 } else { first(a) + sum(rest(a)) } }; map([[1, 2], [3]], sum)",
+		"let f = fn() { f() }; f()",
+		"fn(x, y) { let z = x + y; z * 2 }",
+		"let n = 1; let add = fn(x) { fn(y) { x + y + n } }; [add(1), add, len]",
+		"{fn(x) { x }: 1}",
+		"{1: 2}[fn() { }]",
+		"fn() { }(1)",
+		"[type(fn() { }), type(len)]",
+		fmt.Sprintf("len([%s0])", strings.Repeat("0, ", 3*StackSize)),
+	}
+
+	for _, input := range inputs {
+		program := parse(t, input)
+
+		expected := evaluator.Eval(program, object.NewEnvironment()).Inspect()
+
+		c := compiler.New()
+		if err := c.Compile(program); err != nil {
+			t.Fatalf("%q: compiler error: %s", input, err)
+		}
+
+		vm := New(c.Bytecode())
+		var actual string
+		if err := vm.Run(); err != nil {
+			actual = (&object.Error{Message: err.Error()}).Inspect()
+		} else {
+			actual = vm.LastPoppedStackElem().Inspect()
+		}
+
+		if actual != expected {
+			t.Errorf("%q: evaluator gave %q, vm gave %q", input, expected, actual)
+		}
+	}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		vm := New(compile(t, tt.input))
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", tt.input, err)
+		}
+
+		stackElem := vm.LastPoppedStackElem()
+
+		testExpectedObject(t, tt.input, tt.expected, stackElem)
+	}
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		result, ok := actual.(*object.Integer)
+		if !ok || result.Value != int64(expected) {
+			t.Errorf("%q: expected integer %d, got %T (%+v)", input, expected, actual, actual)
+		}
+	case float64:
+		result, ok := actual.(*object.Float)
+		if !ok || result.Value != expected {
+			t.Errorf("%q: expected float %g, got %T (%+v)", input, expected, actual, actual)
+		}
+	case bool:
+		result, ok := actual.(*object.Boolean)
+		if !ok || result.Value != expected {
+			t.Errorf("%q: expected boolean %t, got %T (%+v)", input, expected, actual, actual)
+		}
+	case string:
+		result, ok := actual.(*object.String)
+		if !ok || result.Value != expected {
+			t.Errorf("%q: expected string %q, got %T (%+v)", input, expected, actual, actual)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok || len(array.Elements) != len(expected) {
+			t.Errorf("%q: expected array %v, got %T (%+v)", input, expected, actual, actual)
+			return
+		}
+		for i, e := range expected {
+			testExpectedObject(t, input, e, array.Elements[i])
+		}
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("%q: expected null, got %T (%+v)", input, actual, actual)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser has %d errors for %q: %v", len(errs), input, errs)
+	}
+
+	return program
+}
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	c := compiler.New()
+	if err := c.Compile(parse(t, input)); err != nil {
+		t.Fatalf("%q: compiler error: %s", input, err)
+	}
+
+	return c.Bytecode()
+}